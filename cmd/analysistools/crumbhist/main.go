@@ -1,29 +1,46 @@
 package main
 
 import (
-	"fmt"
+	"flag"
 	"log"
 	"os"
+	"strings"
 
+	_ "image/gif"
 	_ "image/png"
 
-	"github.com/Kagamiin/pixcrumb/cmd/comp/codingmethods"
+	"github.com/Kagamiin/pixcrumb/cmd/comp"
 	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
 )
 
+var (
+	outputFormat = flag.String("format", "text", "output format (text, json, csv)")
+	perFile      = flag.Bool("perfile", false, "also output statistics for each file")
+	perPlane     = flag.Bool("perplane", false, "also output statistics for each bitplane of each file")
+	codecName    = flag.String("codec", "pcrle", "codec whose compressed size is reported next to the entropy estimates ("+strings.Join(comp.GetPixCrumbCodecNames(), ", ")+")")
+)
+
 func main() {
 	log.SetFlags(0)
+	flag.Parse()
 
-	if len(os.Args) < 2 {
+	if flag.NArg() < 1 {
 		log.Fatal("error: an input file must be specified")
 	}
 
-	var crumbBins [16]uint64
-	var crumbPredictBins [16][16]uint64
-	var crumbCount uint64
-	var lastCrumb imgtools.Crumb
+	codec, err := comp.NewPixCrumbCodecByName(*codecName)
+	if err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+	writeStats, ok := statsWriters[*outputFormat]
+	if !ok {
+		log.Fatalf("ERROR: unknown output format '%s'", *outputFormat)
+	}
+
+	var results []*crumbStats
+	total := &crumbStats{Plane: -1}
 
-	for _, filename := range os.Args[1:] {
+	for _, filename := range flag.Args() {
 		img, err := imgtools.LoadImage(filename)
 		if err != nil {
 			log.Fatalf("\nERROR: Could not load image file '%s': %s\n\n", filename, err.Error())
@@ -42,50 +59,27 @@ func main() {
 		crumbImage := imgtools.ImagePlanarToCrumb(planarImg)
 		crumbPlanes := crumbImage.GetPlanes()
 
-		for _, plane := range crumbPlanes {
-			crumbMtx := plane.GetCrumbs()
-			for _, row := range crumbMtx {
-				for _, crumb := range row {
-					if crumb != 0 || lastCrumb != 0 {
-						crumbBins[crumb]++
-						crumbCount++
-					}
-					lastCrumb = crumb
-				}
-			}
-
-			reader, err := codingmethods.NewCrumbReader(&crumbMtx)
+		fileStats := &crumbStats{File: filename, Plane: -1}
+		for i, plane := range crumbPlanes {
+			planeStats, err := collectPlaneStats(filename, i, &plane, codec)
 			if err != nil {
-				panic(err)
+				log.Fatalf("ERROR: %s", err.Error())
 			}
-			lastCrumb, _ = reader.ReadCrumb()
-			for !reader.IsAtEnd() {
-				crumb, _ := reader.ReadCrumb()
-				if crumb != 0 || lastCrumb != 0 {
-					crumbPredictBins[lastCrumb][crumb]++
-				}
-				lastCrumb = crumb
+			fileStats.add(planeStats)
+			if *perPlane {
+				results = append(results, planeStats)
 			}
 		}
-	}
-
-	fmt.Print("\n\nFrequency data:")
-	for i, cnt := range crumbBins {
-		if i != 15 {
-			fmt.Printf("%d,", cnt)
-		} else {
-			fmt.Printf("%d\n", cnt)
+		fileStats.computeEntropy()
+		total.add(fileStats)
+		if *perFile {
+			results = append(results, fileStats)
 		}
 	}
-	fmt.Println("\nPrediction data:")
-	for j, row := range crumbPredictBins {
-		fmt.Printf("%d,", crumbBins[j])
-		for i, cnt := range row {
-			if i != 15 {
-				fmt.Printf("%d,", cnt)
-			} else {
-				fmt.Printf("%d\n", cnt)
-			}
-		}
+	total.computeEntropy()
+	results = append(results, total)
+
+	if err := writeStats(os.Stdout, results); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
 	}
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var statsWriters = map[string]func(w io.Writer, results []*crumbStats) error{
+	"text": writeStatsText,
+	"json": writeStatsJSON,
+	"csv":  writeStatsCSV,
+}
+
+func describeStats(s *crumbStats) string {
+	switch {
+	case s.File == "":
+		return "Total"
+	case s.Plane < 0:
+		return s.File
+	default:
+		return fmt.Sprintf("%s, plane %d", s.File, s.Plane)
+	}
+}
+
+func writeCommaList(w io.Writer, values []uint64) {
+	for i, cnt := range values {
+		if i != len(values)-1 {
+			fmt.Fprintf(w, "%d,", cnt)
+		} else {
+			fmt.Fprintf(w, "%d\n", cnt)
+		}
+	}
+}
+
+func writeStatsText(w io.Writer, results []*crumbStats) error {
+	for _, s := range results {
+		fmt.Fprintf(w, "\n\n== %s ==\n", describeStats(s))
+		fmt.Fprint(w, "Frequency data:")
+		writeCommaList(w, s.Frequencies[:])
+		fmt.Fprintln(w, "\nPrediction data:")
+		for j, row := range s.Predictions {
+			fmt.Fprintf(w, "%d,", s.Frequencies[j])
+			writeCommaList(w, row[:])
+		}
+		fmt.Fprintf(w, "\nCrumbs: %d\n", s.Crumbs)
+		fmt.Fprintf(w, "Order-0 entropy: %.4f bits/crumb (%.1f bytes)\n", s.Order0Entropy, s.Order0Bytes())
+		fmt.Fprintf(w, "Order-1 entropy: %.4f bits/crumb (%.1f bytes)\n", s.Order1Entropy, s.Order1Bytes())
+		fmt.Fprintf(w, "Compressed with %s: %d bytes\n", *codecName, s.CompressedBytes)
+	}
+	return nil
+}
+
+func writeStatsJSON(w io.Writer, results []*crumbStats) error {
+	type jsonStats struct {
+		*crumbStats
+		Codec       string  `json:"codec"`
+		Order0Bytes float64 `json:"order0Bytes"`
+		Order1Bytes float64 `json:"order1Bytes"`
+	}
+	out := make([]jsonStats, len(results))
+	for i, s := range results {
+		out[i] = jsonStats{s, *codecName, s.Order0Bytes(), s.Order1Bytes()}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// writeStatsCSV writes one row per result; transition counts are left out, use JSON for those.
+func writeStatsCSV(w io.Writer, results []*crumbStats) error {
+	cw := csv.NewWriter(w)
+	header := []string{"file", "plane", "crumbs", "order0_entropy", "order1_entropy", "order0_bytes", "order1_bytes", "codec", "compressed_bytes"}
+	for i := range 16 {
+		header = append(header, fmt.Sprintf("freq%d", i))
+	}
+	for i := range 16 {
+		header = append(header, fmt.Sprintf("all_freq%d", i))
+	}
+	cw.Write(header)
+
+	for _, s := range results {
+		file := s.File
+		if file == "" {
+			file = "total"
+		}
+		plane := ""
+		if s.Plane >= 0 {
+			plane = strconv.Itoa(s.Plane)
+		}
+		record := []string{
+			file,
+			plane,
+			strconv.FormatUint(s.Crumbs, 10),
+			strconv.FormatFloat(s.Order0Entropy, 'f', 6, 64),
+			strconv.FormatFloat(s.Order1Entropy, 'f', 6, 64),
+			strconv.FormatFloat(s.Order0Bytes(), 'f', 1, 64),
+			strconv.FormatFloat(s.Order1Bytes(), 'f', 1, 64),
+			*codecName,
+			strconv.FormatUint(s.CompressedBytes, 10),
+		}
+		for _, cnt := range s.Frequencies {
+			record = append(record, strconv.FormatUint(cnt, 10))
+		}
+		for _, cnt := range s.AllFrequencies {
+			record = append(record, strconv.FormatUint(cnt, 10))
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp"
+	"github.com/Kagamiin/pixcrumb/cmd/comp/codingmethods"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+// crumbStats holds the statistics of one bitplane, or the sum of several.
+type crumbStats struct {
+	File  string `json:"file,omitempty"`
+	Plane int    `json:"plane"` // -1 for sums over several planes
+
+	Crumbs uint64 `json:"crumbs"`
+	// Frequency and prediction data as used for the built-in dictionaries, which leave out zero crumbs following
+	// other zero crumbs since those are handled by run-length coding.
+	Frequencies [16]uint64     `json:"frequencies"`
+	Predictions [16][16]uint64 `json:"predictions"`
+	// Counts over every crumb, in CrumbReader order, for the entropy estimates.
+	AllFrequencies  [16]uint64     `json:"allFrequencies"`
+	AllTransitions  [16][16]uint64 `json:"allTransitions"`
+	CompressedBytes uint64         `json:"compressedBytes"`
+
+	Order0Entropy float64 `json:"order0Entropy"`
+	Order1Entropy float64 `json:"order1Entropy"`
+}
+
+func collectPlaneStats(filename string, planeIdx int, plane *imgtools.CrumbPlane, codec comp.PixCrumbEncoder) (*crumbStats, error) {
+	stats := &crumbStats{File: filename, Plane: planeIdx}
+
+	crumbMtx := plane.GetCrumbs()
+	var lastCrumb imgtools.Crumb
+	for _, row := range crumbMtx {
+		for _, crumb := range row {
+			if crumb != 0 || lastCrumb != 0 {
+				stats.Frequencies[crumb]++
+			}
+			lastCrumb = crumb
+		}
+	}
+
+	reader, err := codingmethods.NewCrumbReader(&crumbMtx)
+	if err != nil {
+		return nil, err
+	}
+	lastCrumb, err = reader.ReadCrumb()
+	if err != nil {
+		return nil, err
+	}
+	stats.AllFrequencies[lastCrumb]++
+	stats.Crumbs++
+	for !reader.IsAtEnd() {
+		crumb, err := reader.ReadCrumb()
+		if err != nil {
+			return nil, err
+		}
+		if crumb != 0 || lastCrumb != 0 {
+			stats.Predictions[lastCrumb][crumb]++
+		}
+		stats.AllFrequencies[crumb]++
+		stats.AllTransitions[lastCrumb][crumb]++
+		stats.Crumbs++
+		lastCrumb = crumb
+	}
+
+	blob, err := codec.Compress(plane)
+	if err != nil {
+		return nil, err
+	}
+	stats.CompressedBytes = blob.GetTotalSize()
+
+	stats.computeEntropy()
+	return stats, nil
+}
+
+// add sums other into s; entropies must be recomputed afterwards.
+func (s *crumbStats) add(other *crumbStats) {
+	s.Crumbs += other.Crumbs
+	s.CompressedBytes += other.CompressedBytes
+	for i := range 16 {
+		s.Frequencies[i] += other.Frequencies[i]
+		s.AllFrequencies[i] += other.AllFrequencies[i]
+		for j := range 16 {
+			s.Predictions[i][j] += other.Predictions[i][j]
+			s.AllTransitions[i][j] += other.AllTransitions[i][j]
+		}
+	}
+}
+
+// shannonEntropy returns the entropy in bits per symbol of a frequency distribution.
+func shannonEntropy(freqs []uint64) float64 {
+	var total uint64
+	for _, f := range freqs {
+		total += f
+	}
+	var result float64
+	for _, f := range freqs {
+		if f != 0 {
+			p := float64(f) / float64(total)
+			result -= p * math.Log2(p)
+		}
+	}
+	return result
+}
+
+func (s *crumbStats) computeEntropy() {
+	s.Order0Entropy = shannonEntropy(s.AllFrequencies[:])
+
+	var totalTransitions uint64
+	s.Order1Entropy = 0
+	for _, row := range s.AllTransitions {
+		for _, cnt := range row {
+			totalTransitions += cnt
+		}
+	}
+	if totalTransitions == 0 {
+		s.Order1Entropy = s.Order0Entropy
+		return
+	}
+	for _, row := range s.AllTransitions {
+		var rowTotal uint64
+		for _, cnt := range row {
+			rowTotal += cnt
+		}
+		s.Order1Entropy += float64(rowTotal) / float64(totalTransitions) * shannonEntropy(row[:])
+	}
+}
+
+// Order0Bytes and Order1Bytes are the theoretical lower bounds for coding the crumbs with the respective models.
+func (s *crumbStats) Order0Bytes() float64 {
+	return s.Order0Entropy * float64(s.Crumbs) / 8
+}
+
+func (s *crumbStats) Order1Bytes() float64 {
+	return s.Order1Entropy * float64(s.Crumbs) / 8
+}
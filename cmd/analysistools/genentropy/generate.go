@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"slices"
+	"text/template"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp/codingmethods"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+type dictEntry struct {
+	Symbol string
+	Code   string
+	Length uint
+}
+
+var entropyTemplate = template.Must(template.New("entropy.go").Parse(`// Code generated by genentropy; DO NOT EDIT.
+
+package codingmethods
+
+import "github.com/Kagamiin/pixcrumb/cmd/imgtools"
+
+// crumbHistogram counts crumbs over the training corpus, leaving out zero crumbs that follow other zero crumbs.
+var crumbHistogram = [16]uint64{ {{- range $i, $c := .Frequencies}}{{if $i}}, {{end}}{{$c}}{{end -}} }
+
+// crumbTransitionHistogram[prev][c] counts crumb c following crumb prev in CrumbReader order, with the same exclusion.
+var crumbTransitionHistogram = [16][16]uint64{
+{{- range .Predictions}}
+	{ {{- range $i, $c := .}}{{if $i}}, {{end}}{{$c}}{{end -}} },
+{{- end}}
+}
+
+var DictRLE = map[imgtools.Crumb]bitDictWord{
+{{- range .DictRLE}}
+	{{.Symbol}}: { {{- .Code}}, {{.Length -}} },
+{{- end}}
+}
+
+var DictLZ = map[imgtools.Crumb]bitDictWord{
+{{- range .DictLZ}}
+	{{.Symbol}}: { {{- .Code}}, {{.Length -}} },
+{{- end}}
+}
+`))
+
+func formatSymbol(c imgtools.Crumb) string {
+	if c == codingmethods.TOKEN_END_OF_LITERALS {
+		return "TOKEN_END_OF_LITERALS"
+	}
+	return fmt.Sprintf("0x%X", uint8(c))
+}
+
+// dictEntries lists a prefix code in code order, the way the hand-written tables used to be laid out.
+func dictEntries(dict codingmethods.BitDict) []dictEntry {
+	var symbols []imgtools.Crumb
+	for c := range dict {
+		symbols = append(symbols, c)
+	}
+	slices.SortFunc(symbols, func(a, b imgtools.Crumb) int {
+		if la, lb := dict[a].Length(), dict[b].Length(); la != lb {
+			return int(la) - int(lb)
+		}
+		return int(dict[a].Value()) - int(dict[b].Value())
+	})
+	result := make([]dictEntry, len(symbols))
+	for i, c := range symbols {
+		w := dict[c]
+		result[i] = dictEntry{
+			Symbol: formatSymbol(c),
+			Code:   fmt.Sprintf("0b%0*b", w.Length(), w.Value()),
+			Length: w.Length(),
+		}
+	}
+	return result
+}
+
+func generate(stats *corpusStats) ([]byte, error) {
+	dictRLE, err := codingmethods.BuildCanonicalBitDict(stats.Frequencies[:], *rleMaxLength)
+	if err != nil {
+		return nil, fmt.Errorf("could not build DictRLE: %w", err)
+	}
+	// The end-of-literals token replaces the zero crumb that ends each literal run, so it is given the same frequency.
+	lzFreqs := append(stats.Frequencies[:], stats.Frequencies[0])
+	dictLZ, err := codingmethods.BuildCanonicalBitDict(lzFreqs, *lzMaxLength)
+	if err != nil {
+		return nil, fmt.Errorf("could not build DictLZ: %w", err)
+	}
+
+	var buf bytes.Buffer
+	err = entropyTemplate.Execute(&buf, struct {
+		*corpusStats
+		DictRLE []dictEntry
+		DictLZ  []dictEntry
+	}{stats, dictEntries(dictRLE), dictEntries(dictLZ)})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
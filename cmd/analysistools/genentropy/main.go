@@ -0,0 +1,165 @@
+// genentropy builds the crumb histograms and built-in prefix code tables of the codingmethods package out of a corpus
+// and writes them out as entropy.go. Inputs are image files, directories of images, or the JSON output of
+// crumbhist -format json; statistics from all inputs are added together.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp/codingmethods"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+var (
+	outFile      = flag.String("out", "", "file to write the generated code to (default: stdout)")
+	rleMaxLength = flag.Uint("rlemaxlen", 7, "maximum code length of DictRLE")
+	lzMaxLength  = flag.Uint("lzmaxlen", 8, "maximum code length of DictLZ")
+)
+
+// corpusStats uses the same layout as crumbhist's JSON output, so that its totals can be fed back in directly.
+type corpusStats struct {
+	Frequencies [16]uint64     `json:"frequencies"`
+	Predictions [16][16]uint64 `json:"predictions"`
+}
+
+func (cs *corpusStats) add(other *corpusStats) {
+	for i := range 16 {
+		cs.Frequencies[i] += other.Frequencies[i]
+		for j := range 16 {
+			cs.Predictions[i][j] += other.Predictions[i][j]
+		}
+	}
+}
+
+// addImage counts crumbs the same way crumbhist does: zero crumbs following other zero crumbs are left out, since
+// run-length coding takes care of them.
+func (cs *corpusStats) addImage(filename string) error {
+	img, err := imgtools.LoadImage(filename)
+	if err != nil {
+		return err
+	}
+	planarImg, err := imgtools.NewPlanarImage(img)
+	if err != nil {
+		return err
+	}
+	for _, bp := range planarImg.GetBitplanes() {
+		bp.DeltaEncode()
+	}
+
+	for _, plane := range imgtools.ImagePlanarToCrumb(planarImg).GetPlanes() {
+		crumbMtx := plane.GetCrumbs()
+		var lastCrumb imgtools.Crumb
+		for _, row := range crumbMtx {
+			for _, crumb := range row {
+				if crumb != 0 || lastCrumb != 0 {
+					cs.Frequencies[crumb]++
+				}
+				lastCrumb = crumb
+			}
+		}
+
+		reader, err := codingmethods.NewCrumbReader(&crumbMtx)
+		if err != nil {
+			return err
+		}
+		lastCrumb, err = reader.ReadCrumb()
+		if err != nil {
+			return err
+		}
+		for !reader.IsAtEnd() {
+			crumb, err := reader.ReadCrumb()
+			if err != nil {
+				return err
+			}
+			if crumb != 0 || lastCrumb != 0 {
+				cs.Predictions[lastCrumb][crumb]++
+			}
+			lastCrumb = crumb
+		}
+	}
+	return nil
+}
+
+// addJSON adds the totals (the entry without a file name) from crumbhist's JSON output.
+func (cs *corpusStats) addJSON(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var entries []struct {
+		File string `json:"file"`
+		corpusStats
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.File == "" {
+			cs.add(&e.corpusStats)
+			return nil
+		}
+	}
+	return fmt.Errorf("no totals found in '%s'", filename)
+}
+
+func (cs *corpusStats) addInput(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			return cs.addJSON(path)
+		}
+		return cs.addImage(path)
+	}
+	// Directories may contain other files besides images; those are skipped with a warning.
+	return filepath.WalkDir(path, func(filename string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if err := cs.addImage(filename); err != nil {
+			log.Printf("warning: skipping '%s': %s", filename, err.Error())
+		}
+		return nil
+	})
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatal("error: at least one corpus input must be specified")
+	}
+
+	var stats corpusStats
+	for _, path := range flag.Args() {
+		if err := stats.addInput(path); err != nil {
+			log.Fatalf("ERROR: could not read corpus input '%s': %s", path, err.Error())
+		}
+	}
+
+	src, err := generate(&stats)
+	if err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+
+	if *outFile == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*outFile, src, 0644); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+}
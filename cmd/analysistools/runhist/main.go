@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+var (
+	outputFormat   = flag.String("format", "text", "output format (text, json, csv)")
+	perFile        = flag.Bool("perfile", false, "also output statistics for each file")
+	order1Literals = flag.Bool("order1", false, "measure the order-1 Huffman literal coder (pcrleo1) instead of 4-bit literals")
+	golombOrder    = flag.Uint("golomb", 2, "exp-Golomb order of the zero run lengths")
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		log.Fatal("error: an input file must be specified")
+	}
+	writeStats, ok := statsWriters[*outputFormat]
+	if !ok {
+		log.Fatalf("ERROR: unknown output format '%s'", *outputFormat)
+	}
+
+	var results []*runStats
+	total := &runStats{}
+
+	for _, filename := range flag.Args() {
+		img, err := imgtools.LoadImage(filename)
+		if err != nil {
+			log.Fatalf("\nERROR: Could not load image file '%s': %s\n\n", filename, err.Error())
+		}
+
+		planarImg, err := imgtools.NewPlanarImage(img)
+		if err != nil {
+			log.Fatalf("ERROR: %s", err.Error())
+		}
+		for _, bp := range planarImg.GetBitplanes() {
+			bp.DeltaEncode()
+		}
+
+		crumbImage := imgtools.ImagePlanarToCrumb(planarImg)
+
+		fileStats := &runStats{File: filename}
+		for _, plane := range crumbImage.GetPlanes() {
+			if err := collectRunStats(fileStats, &plane, *order1Literals, uint16(*golombOrder)); err != nil {
+				log.Fatalf("ERROR: %s", err.Error())
+			}
+		}
+		total.add(fileStats)
+		if *perFile {
+			results = append(results, fileStats)
+		}
+	}
+	results = append(results, total)
+
+	if err := writeStats(os.Stdout, results); err != nil {
+		log.Fatalf("ERROR: %s", err.Error())
+	}
+}
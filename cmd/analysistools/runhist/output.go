@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var statsWriters = map[string]func(w io.Writer, results []*runStats) error{
+	"text": writeStatsText,
+	"json": writeStatsJSON,
+	"csv":  writeStatsCSV,
+}
+
+func describeStats(s *runStats) string {
+	if s.File == "" {
+		return "Total"
+	}
+	return s.File
+}
+
+func writeTokenStatsText(w io.Writer, name string, ts *tokenStats) {
+	fmt.Fprintf(w, "%s: %d tokens (%d empty), %d crumbs, %d bits", name, ts.Count, ts.Empty, ts.Crumbs, ts.Bits)
+	if ts.Count > 0 {
+		fmt.Fprintf(w, " (%.2f bits/token", float64(ts.Bits)/float64(ts.Count))
+		if ts.Crumbs > 0 {
+			fmt.Fprintf(w, ", %.2f bits/crumb", float64(ts.Bits)/float64(ts.Crumbs))
+		}
+		fmt.Fprint(w, ")")
+	}
+	fmt.Fprintln(w)
+	for _, length := range ts.sortedLengths() {
+		fmt.Fprintf(w, "  %5d: %d\n", length, ts.Lengths[length])
+	}
+}
+
+func writeStatsText(w io.Writer, results []*runStats) error {
+	for _, s := range results {
+		fmt.Fprintf(w, "\n== %s ==\n", describeStats(s))
+		writeTokenStatsText(w, "Literal runs", &s.Literals)
+		writeTokenStatsText(w, "Zero runs", &s.ZeroRuns)
+		fmt.Fprintf(w, "Mode switches: %d\n", s.ModeSwitches)
+		fmt.Fprintln(w, "Zero run bits by exp-Golomb order:")
+		for order, nBits := range s.ZeroRunBitsByGolombOrder {
+			fmt.Fprintf(w, "  %d: %d\n", order, nBits)
+		}
+	}
+	return nil
+}
+
+func writeStatsJSON(w io.Writer, results []*runStats) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// writeStatsCSV writes the length histograms, one row per token type and length.
+func writeStatsCSV(w io.Writer, results []*runStats) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"file", "token", "length", "count"})
+	for _, s := range results {
+		file := s.File
+		if file == "" {
+			file = "total"
+		}
+		for _, tok := range []struct {
+			name  string
+			stats *tokenStats
+		}{{"literal", &s.Literals}, {"zero", &s.ZeroRuns}} {
+			for _, length := range tok.stats.sortedLengths() {
+				cw.Write([]string{
+					file,
+					tok.name,
+					strconv.FormatUint(length, 10),
+					strconv.FormatUint(tok.stats.Lengths[length], 10),
+				})
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
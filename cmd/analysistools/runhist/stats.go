@@ -0,0 +1,129 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp/codingmethods"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+const maxReportedGolombOrder = 6
+
+// tokenStats describes one kind of token emitted by the pixcrumb-rle coders.
+type tokenStats struct {
+	Count uint64 `json:"count"`
+	// tokens that cover no crumbs at all, which only cost a mode switch
+	Empty  uint64 `json:"empty"`
+	Crumbs uint64 `json:"crumbs"`
+	Bits   uint64 `json:"bits"`
+	// token length (in crumbs) -> number of tokens
+	Lengths map[uint64]uint64 `json:"lengths"`
+}
+
+func (ts *tokenStats) record(nCrumbs uint64, nBits uint64) {
+	if ts.Lengths == nil {
+		ts.Lengths = make(map[uint64]uint64)
+	}
+	ts.Count++
+	if nCrumbs == 0 {
+		ts.Empty++
+	}
+	ts.Crumbs += nCrumbs
+	ts.Bits += nBits
+	ts.Lengths[nCrumbs]++
+}
+
+func (ts *tokenStats) add(other *tokenStats) {
+	for length, count := range other.Lengths {
+		if ts.Lengths == nil {
+			ts.Lengths = make(map[uint64]uint64)
+		}
+		ts.Lengths[length] += count
+	}
+	ts.Count += other.Count
+	ts.Empty += other.Empty
+	ts.Crumbs += other.Crumbs
+	ts.Bits += other.Bits
+}
+
+func (ts *tokenStats) sortedLengths() []uint64 {
+	var result []uint64
+	for length := range ts.Lengths {
+		result = append(result, length)
+	}
+	slices.Sort(result)
+	return result
+}
+
+type runStats struct {
+	File         string     `json:"file,omitempty"`
+	Literals     tokenStats `json:"literals"`
+	ZeroRuns     tokenStats `json:"zeroRuns"`
+	ModeSwitches uint64     `json:"modeSwitches"`
+	// bits the zero runs would take with each exp-Golomb order
+	ZeroRunBitsByGolombOrder [maxReportedGolombOrder + 1]uint64 `json:"zeroRunBitsByGolombOrder"`
+}
+
+func (rs *runStats) add(other *runStats) {
+	rs.Literals.add(&other.Literals)
+	rs.ZeroRuns.add(&other.ZeroRuns)
+	rs.ModeSwitches += other.ModeSwitches
+	for i := range rs.ZeroRunBitsByGolombOrder {
+		rs.ZeroRunBitsByGolombOrder[i] += other.ZeroRunBitsByGolombOrder[i]
+	}
+}
+
+// collectRunStats runs the literal and zero-RLE coders over a crumb plane the same way pixcrumb-rle does, recording
+// what each call produces. Literal runs include their zero terminator in the bit cost but not in the length; zero run
+// lengths are the values stored in the RLE stream, which leave out that terminator.
+func collectRunStats(stats *runStats, plane *imgtools.CrumbPlane, order1Literals bool, golombOrder uint16) error {
+	crumbMtx := plane.GetCrumbs()
+	crumbReader, err := codingmethods.NewCrumbReader(&crumbMtx)
+	if err != nil {
+		return err
+	}
+	// The coders need somewhere to write; only their return values are of interest.
+	var scratch []byte
+	writer := codingmethods.NewBitstreamMSBWriter(&scratch)
+
+	var literalEncoder codingmethods.CodingMethod
+	if order1Literals {
+		literalEncoder, err = codingmethods.NewOrder1HuffmanCrumbLiteralCoder(crumbReader, writer, nil, nil, nil)
+	} else {
+		literalEncoder, err = codingmethods.NewZeroTerminated4BitCrumbLiteralCoder(crumbReader, writer, nil, nil)
+	}
+	if err != nil {
+		return err
+	}
+	rleEncoder, err := codingmethods.NewExpGolombCodedZeroRLECoder(crumbReader, writer, nil, nil, golombOrder)
+	if err != nil {
+		return err
+	}
+
+	rleMode := false
+	firstToken := true
+	for !crumbReader.IsAtEnd() {
+		if !firstToken {
+			stats.ModeSwitches++
+		}
+		firstToken = false
+		if !rleMode {
+			nCrumbs, nBits, err := literalEncoder.EncodeSome()
+			if err != nil {
+				return err
+			}
+			stats.Literals.record(nCrumbs, nBits)
+		} else {
+			nCrumbs, nBits, err := rleEncoder.EncodeSome()
+			if err != nil {
+				return err
+			}
+			stats.ZeroRuns.record(nCrumbs, nBits)
+			for order := range stats.ZeroRunBitsByGolombOrder {
+				stats.ZeroRunBitsByGolombOrder[order] += codingmethods.GetNumBitsOrderKExpGolombNumber16(uint16(nCrumbs), uint16(order))
+			}
+		}
+		rleMode = !rleMode
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+type animationReference int
+
+const (
+	// XOR delta frames with the frame right before them
+	referencePrevious animationReference = iota
+	// XOR delta frames with the last keyframe
+	referenceKeyframe
+	// try both and keep whichever compresses better
+	referenceBest
+)
+
+func parseAnimationReference(name string) (animationReference, error) {
+	switch name {
+	case "previous":
+		return referencePrevious, nil
+	case "keyframe":
+		return referenceKeyframe, nil
+	case "best":
+		return referenceBest, nil
+	}
+	return 0, fmt.Errorf("unknown reference frame mode '%s' (expected previous, keyframe or best)", name)
+}
+
+type animationOptions struct {
+	// a keyframe is forced every keyframeInterval frames; otherwise frames only become keyframes when that is smaller
+	keyframeInterval int
+	reference        animationReference
+}
+
+// compressFrame compresses a copy of img, mask included, returning the marshaled blobs and their total size.
+func compressFrame(img *imgtools.PlanarImage, codec comp.PixCrumbEncoder) (planes [][]byte, size int, err error) {
+	blobs, _, err := compressPlanarImage(img.Clone(), codec)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, blob := range blobs {
+		data, err := blob.Marshal()
+		if err != nil {
+			return nil, 0, err
+		}
+		planes = append(planes, data)
+		size += len(data)
+	}
+	return planes, size, nil
+}
+
+// encodeAnimation compresses every frame both on its own and XORed with a reference frame, storing whichever is
+// smaller in the container. If the frames have masks, the container is flagged as having one.
+func encodeAnimation(frames []imgtools.AnimationFrame, codec comp.PixCrumbEncoder, opts animationOptions) (*comp.Container, error) {
+	first := frames[0].Image
+	result := &comp.Container{
+		Width:     int(first.GetWidthPx()),
+		Height:    int(first.GetHeightPx()),
+		NumPlanes: len(first.GetBitplanes()),
+		CodecName: codec.GetAbbrevName(),
+		Palette:   first.GetPalette(),
+	}
+	if first.GetMask() != nil {
+		result.Flags |= comp.ContainerMask
+	}
+
+	lastKeyframe := 0
+	for i, frame := range frames {
+		planes, size, err := compressFrame(frame.Image, codec)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		containerFrame := comp.ContainerFrame{Flags: comp.ContainerFrameKeyframe, DelayCs: frame.DelayCs, Planes: planes}
+
+		if i > 0 && (opts.keyframeInterval == 0 || i%opts.keyframeInterval != 0) {
+			var candidates []int
+			if opts.reference != referenceKeyframe {
+				candidates = append(candidates, i-1)
+			}
+			if opts.reference == referenceKeyframe || (opts.reference == referenceBest && lastKeyframe != i-1) {
+				candidates = append(candidates, lastKeyframe)
+			}
+			for _, ref := range candidates {
+				delta := frame.Image.Clone()
+				if err := delta.XOR(frames[ref].Image); err != nil {
+					return nil, fmt.Errorf("frame %d: %w", i, err)
+				}
+				deltaPlanes, deltaSize, err := compressFrame(delta, codec)
+				if err != nil {
+					return nil, fmt.Errorf("frame %d: %w", i, err)
+				}
+				if deltaSize < size {
+					containerFrame.Flags &^= comp.ContainerFrameKeyframe
+					containerFrame.Reference = ref
+					containerFrame.Planes = deltaPlanes
+					size = deltaSize
+				}
+			}
+		}
+		if containerFrame.IsKeyframe() {
+			lastKeyframe = i
+		}
+		result.Frames = append(result.Frames, containerFrame)
+	}
+	return result, nil
+}
+
+// decodeContainerPlanes decodes the bitplanes of one container frame, mask included, without undoing the XOR with its
+// reference.
+func decodeContainerPlanes(c *comp.Container, frame *comp.ContainerFrame) ([]imgtools.Bitplane, error) {
+	return decodeBitplanes(c.CodecName, frame.Planes, uint64(c.Width), uint64(c.Height))
+}
+
+// decodeAnimation decodes every frame of a container, along with its mask in containers that have one.
+func decodeAnimation(c *comp.Container) ([]*imgtools.PlanarImage, error) {
+	var frames []*imgtools.PlanarImage
+	for i := range c.Frames {
+		frame := &c.Frames[i]
+		planes, err := decodeContainerPlanes(c, frame)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		img, err := newPlanarImageFromDecodedPlanes(planes, c.Palette, c.HasMask())
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		if !frame.IsKeyframe() {
+			if err := img.XOR(frames[frame.Reference]); err != nil {
+				return nil, fmt.Errorf("frame %d: %w", i, err)
+			}
+		}
+		frames = append(frames, img)
+	}
+	return frames, nil
+}
+
+func loadAnimation(filenames []string, opts imgtools.PaletteOptions) ([]imgtools.AnimationFrame, error) {
+	if len(filenames) == 1 && strings.EqualFold(filepath.Ext(filenames[0]), ".gif") {
+		return imgtools.LoadAnimatedGIF(filenames[0], opts)
+	}
+	return imgtools.LoadAnimationFrames(filenames, opts)
+}
+
+func runAnim(args []string) {
+	flags := flag.NewFlagSet("anim", flag.ExitOnError)
+	codecName := flags.String("codec", "pcrle", "codec to compress with ("+strings.Join(comp.GetPixCrumbCodecNames(), ", ")+")")
+	outFile := flags.String("o", "", "output container file (default: first input file name + .pxc)")
+	keyframeInterval := flags.Int("keyint", 0, "force a keyframe every this many frames (default: only when XORing with the reference frame doesn't help)")
+	referenceMode := flags.String("ref", "previous", "frame that delta frames are XORed with (previous, keyframe, best)")
+	mask := addMaskFlags(flags)
+	verifyOutput := flags.Bool("verify", false, "decode the container and check that every frame matches its input")
+	rawOutFile := flags.String("rawout", "", "also decode the container into this file as raw planar frames, with the mask bitplane first")
+	rawInterleave := flags.String("rawinterleave", "line", "plane interleave mode of -rawout (none, line, word)")
+	palette := addPaletteFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s anim [flags] <animated GIF | frame image files...>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	codec, err := comp.NewPixCrumbCodecByName(*codecName)
+	handle(err)
+	reference, err := parseAnimationReference(*referenceMode)
+	handle(err)
+	rawMode, err := imgtools.ParsePlaneInterleave(*rawInterleave)
+	handle(err)
+	paletteOpts, err := palette.options()
+	handle(err)
+	if *outFile == "" {
+		*outFile = flags.Arg(0) + ".pxc"
+	}
+
+	frames, err := loadAnimation(flags.Args(), paletteOpts)
+	handle(err)
+	if *mask.enabled {
+		transparentIndex, err := mask.transparentIndexFor(frames[0].Image.GetPalette())
+		handle(err)
+		fmt.Printf("Masking out color %d\n", transparentIndex)
+		for _, frame := range frames {
+			handle(frame.Image.SetMask(frame.Image.TransparencyMask(transparentIndex)))
+		}
+	}
+	container, err := encodeAnimation(frames, codec, animationOptions{keyframeInterval: *keyframeInterval, reference: reference})
+	handle(err)
+
+	fmt.Printf("Using method %s, %d frames:\n", codec.GetName(), len(frames))
+	var totalSize, totalSizeIntra int
+	for i, frame := range container.Frames {
+		size := 0
+		for _, data := range frame.Planes {
+			size += len(data)
+		}
+		totalSize += size
+		_, intraSize, err := compressFrame(frames[i].Image, codec)
+		handle(err)
+		totalSizeIntra += intraSize
+		if frame.IsKeyframe() {
+			fmt.Printf("Frame %d: keyframe, %d bytes\n", i, size)
+		} else {
+			fmt.Printf("Frame %d: XORed with frame %d, %d bytes (%d bytes as a keyframe)\n", i, frame.Reference, size, intraSize)
+		}
+	}
+	data, err := container.Marshal()
+	handle(err)
+	fmt.Printf("Total: %d bytes of bitplanes (%d bytes with keyframes only), %d bytes with container\n", totalSize, totalSizeIntra, len(data))
+	handle(os.WriteFile(*outFile, data, 0644))
+	fmt.Printf("Written to %s\n", *outFile)
+
+	if *verifyOutput {
+		handle(verifyAnimation(data, frames))
+		fmt.Println("All frames decoded correctly.")
+	}
+	if *rawOutFile != "" {
+		handle(writeRawAnimation(*rawOutFile, container, rawMode))
+		fmt.Printf("Decoded frames written to %s\n", *rawOutFile)
+	}
+}
+
+// writeRawAnimation decodes a container into a file of raw planar frames, one after the other. The mask, if any, is
+// interleaved with the color bitplanes as the first one.
+func writeRawAnimation(filename string, c *comp.Container, mode imgtools.PlaneInterleave) error {
+	frames, err := decodeAnimation(c)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	for i, frame := range frames {
+		raw, err := imgtools.EncodeRawPlanar(frame.GetBitplanesWithMask(), mode)
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", i, err)
+		}
+		data = append(data, raw...)
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+var ErrAnimationMismatch = errors.New("decoded animation does not match the input")
+
+// verifyAnimation decodes a marshaled container and compares every frame with the input.
+func verifyAnimation(data []byte, frames []imgtools.AnimationFrame) error {
+	var container comp.Container
+	if err := container.Unmarshal(data); err != nil {
+		return err
+	}
+	decoded, err := decodeAnimation(&container)
+	if err != nil {
+		return err
+	}
+	if len(decoded) != len(frames) {
+		return fmt.Errorf("%w: decoded %d frames, expected %d", ErrAnimationMismatch, len(decoded), len(frames))
+	}
+	for i, frame := range frames {
+		if mask := frame.Image.GetMask(); mask != nil {
+			decodedMask := decoded[i].GetMask()
+			if decodedMask == nil {
+				return fmt.Errorf("%w: frame %d has no mask", ErrAnimationMismatch, i)
+			}
+			if x, y, found := firstBitplaneMismatch(mask, decodedMask); found {
+				return fmt.Errorf("%w: mask of frame %d differs at pixel (%d, %d)", ErrAnimationMismatch, i, x, y)
+			}
+		}
+		for y := range frame.Image.GetHeightPx() {
+			for x := range frame.Image.GetWidthPx() {
+				if decoded[i].ColorIndexAt(x, y) != frame.Image.ColorIndexAt(x, y) {
+					return fmt.Errorf("%w: frame %d differs at pixel (%d, %d)", ErrAnimationMismatch, i, x, y)
+				}
+			}
+		}
+	}
+	return nil
+}
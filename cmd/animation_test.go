@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+// TestAnimationMaskMatchesImage checks that anim -mask picks the same transparent color in GIFs as the main command
+// does with -mask, and masks out the same pixels of the first frame.
+func TestAnimationMaskMatchesImage(t *testing.T) {
+	gifFiles, err := filepath.Glob(filepath.Join("testdata", "corpus", "*.gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mask := addMaskFlags(flag.NewFlagSet("mask", flag.ContinueOnError))
+
+	checked := 0
+	for _, gifFile := range gifFiles {
+		img, err := loadPlanarImage(gifFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transparentIndex, err := mask.transparentIndexFor(img.GetPalette())
+		if err != nil {
+			continue
+		}
+		checked++
+		t.Run(filepath.Base(gifFile), func(t *testing.T) {
+			frames, err := loadAnimation([]string{gifFile}, imgtools.PaletteOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			first := frames[0].Image
+			if !slices.Equal(first.GetPalette(), img.GetPalette()) {
+				t.Fatal("the first frame does not have the same palette as the single image")
+			}
+			animIndex, err := mask.transparentIndexFor(first.GetPalette())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if animIndex != transparentIndex {
+				t.Fatalf("transparent color is %d, expected %d", animIndex, transparentIndex)
+			}
+			if x, y, found := firstBitplaneMismatch(img.TransparencyMask(transparentIndex), first.TransparencyMask(animIndex)); found {
+				t.Fatalf("mask differs at pixel (%d, %d)", x, y)
+			}
+		})
+	}
+	if checked == 0 {
+		t.Fatal("no GIF with a transparent color found in the corpus")
+	}
+}
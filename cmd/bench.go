@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+type benchResult struct {
+	File            string        `json:"file,omitempty"`
+	Codec           string        `json:"codec"`
+	RestartRows     int           `json:"restartRows,omitempty"`
+	RawBytes        uint64        `json:"rawBytes"`
+	CompressedBytes uint64        `json:"compressedBytes"`
+	Ratio           float64       `json:"ratio"`
+	EncodeTime      time.Duration `json:"encodeTimeNs"`
+	DecodeTime      time.Duration `json:"decodeTimeNs"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// benchReport is also the baseline format read back by -baseline.
+type benchReport struct {
+	Results []benchResult `json:"results"`
+	Totals  []benchResult `json:"totals"`
+}
+
+func (r *benchResult) add(other *benchResult) {
+	r.RawBytes += other.RawBytes
+	r.CompressedBytes += other.CompressedBytes
+	r.EncodeTime += other.EncodeTime
+	r.DecodeTime += other.DecodeTime
+	r.updateRatio()
+}
+
+func (r *benchResult) updateRatio() {
+	if r.RawBytes != 0 {
+		r.Ratio = float64(r.CompressedBytes) / float64(r.RawBytes)
+	}
+}
+
+// benchImage compresses every plane of an image and decompresses the results again, timing both. A codec panicking
+// only fails its own result, so one broken codec doesn't take the whole benchmark down.
+func benchImage(filename string, codecName string, restartRows int) (result benchResult) {
+	result = benchResult{File: filename, Codec: codecName, RestartRows: restartRows}
+	fail := func(err error) benchResult {
+		result.Error = err.Error()
+		return result
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			result.Error = fmt.Sprintf("codec panicked: %v", r)
+		}
+	}()
+
+	encoder, err := comp.NewPixCrumbCodecByName(codecName)
+	if err != nil {
+		return fail(err)
+	}
+	if restartRows != 0 {
+		restartEncoder, ok := encoder.(comp.PixCrumbRestartEncoder)
+		if !ok {
+			return fail(fmt.Errorf("codec %s does not support restart points", codecName))
+		}
+		if err := restartEncoder.SetRestartInterval(restartRows); err != nil {
+			return fail(err)
+		}
+	}
+	img, err := imgtools.LoadImage(filename)
+	if err != nil {
+		return fail(err)
+	}
+	planarImg, err := imgtools.NewPlanarImage(img)
+	if err != nil {
+		return fail(err)
+	}
+
+	start := time.Now()
+	blobs, rawSizes, err := compressPlanarImage(planarImg, encoder)
+	result.EncodeTime = time.Since(start)
+	if err != nil {
+		return fail(err)
+	}
+	for i, blob := range blobs {
+		result.RawBytes += rawSizes[i]
+		result.CompressedBytes += blob.GetTotalSize()
+	}
+	result.updateRatio()
+
+	start = time.Now()
+	for i, blob := range blobs {
+		decoder, err := comp.NewPixCrumbCodecByName(codecName)
+		if err != nil {
+			return fail(err)
+		}
+		if err := decoder.LoadBlob(blob); err != nil {
+			return fail(fmt.Errorf("error while loading BP%d: %w", i, err))
+		}
+		if _, err := decoder.Decompress(); err != nil {
+			return fail(comp.WithDecodePlane(err, i))
+		}
+	}
+	result.DecodeTime = time.Since(start)
+	return result
+}
+
+// collectBenchFiles expands directories into the files they contain. Files that can't be loaded as images are skipped
+// with a warning.
+func collectBenchFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(filename string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if _, err := imgtools.LoadImage(filename); err != nil {
+				log.Printf("warning: skipping '%s': %s", filename, err.Error())
+				return nil
+			}
+			files = append(files, filename)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// parseRestartRowsList parses the comma-separated restart intervals given to -restartrows.
+func parseRestartRowsList(list string) ([]int, error) {
+	var result []int
+	for _, s := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid restart interval '%s'", s)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// supportsRestartRows reports whether a codec can be benchmarked with the given restart interval. Codecs without
+// restart points are only benchmarked once, with restart points disabled.
+func supportsRestartRows(codecName string, restartRows int) bool {
+	if restartRows == 0 {
+		return true
+	}
+	codec, err := comp.NewPixCrumbCodecByName(codecName)
+	if err != nil {
+		// Let benchImage report the unknown codec.
+		return true
+	}
+	_, ok := codec.(comp.PixCrumbRestartEncoder)
+	return ok
+}
+
+func runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	codecList := flags.String("codecs", strings.Join(comp.GetPixCrumbCodecNames(), ","), "comma-separated list of codecs to benchmark")
+	outputFormat := flags.String("format", "table", "output format (table, json)")
+	baselineFile := flags.String("baseline", "", "fail if compression ratios are worse than in this earlier JSON output")
+	tolerance := flags.Float64("tolerance", 0, "relative ratio increase tolerated by -baseline")
+	restartRowsList := flags.String("restartrows", "0", "comma-separated list of restart intervals in crumb rows to benchmark codecs that support restart points with (0 disables them)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s bench [flags] file-or-directory...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		log.Fatal("error: an input file or directory must be specified")
+	}
+	files, err := collectBenchFiles(flags.Args())
+	handle(err)
+	codecs := strings.Split(*codecList, ",")
+	restartRows, err := parseRestartRowsList(*restartRowsList)
+	handle(err)
+
+	var report benchReport
+	for _, codecName := range codecs {
+		for _, rows := range restartRows {
+			if !supportsRestartRows(codecName, rows) {
+				continue
+			}
+			total := benchResult{Codec: codecName, RestartRows: rows}
+			for _, filename := range files {
+				result := benchImage(filename, codecName, rows)
+				report.Results = append(report.Results, result)
+				if result.Error == "" {
+					total.add(&result)
+				}
+			}
+			report.Totals = append(report.Totals, total)
+		}
+	}
+
+	switch *outputFormat {
+	case "table":
+		writeBenchTable(os.Stdout, &report)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		handle(enc.Encode(&report))
+	default:
+		log.Fatalf("error: unknown output format '%s'", *outputFormat)
+	}
+
+	if *baselineFile != "" {
+		data, err := os.ReadFile(*baselineFile)
+		handle(err)
+		var baseline benchReport
+		handle(json.Unmarshal(data, &baseline))
+		if regressions := findRegressions(&report, &baseline, *tolerance); len(regressions) > 0 {
+			for _, r := range regressions {
+				log.Println("regression:", r)
+			}
+			os.Exit(1)
+		}
+	}
+}
+
+func writeBenchTable(w io.Writer, report *benchReport) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "file\tcodec\trestart\traw\tcompressed\tratio\tencode\tdecode\t")
+	for _, r := range report.Results {
+		if r.Error != "" {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t\t\t\t\t\terror: %s\n", r.File, r.Codec, r.RestartRows, r.Error)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%.3f\t%s\t%s\t\n", r.File, r.Codec, r.RestartRows, r.RawBytes, r.CompressedBytes, r.Ratio, r.EncodeTime, r.DecodeTime)
+	}
+	for _, r := range report.Totals {
+		fmt.Fprintf(tw, "total\t%s\t%d\t%d\t%d\t%.3f\t%s\t%s\t\n", r.Codec, r.RestartRows, r.RawBytes, r.CompressedBytes, r.Ratio, r.EncodeTime, r.DecodeTime)
+	}
+	tw.Flush()
+}
+
+// findRegressions compares per-file and total ratios against a baseline, matching results by file, codec and restart
+// interval. Results that are missing from the baseline (or failed in it) are not compared, but results that used to succeed and now fail count as
+// regressions.
+func findRegressions(report *benchReport, baseline *benchReport, tolerance float64) []string {
+	var regressions []string
+	compare := func(current, previous []benchResult) {
+		for _, cur := range current {
+			idx := slices.IndexFunc(previous, func(prev benchResult) bool {
+				return prev.File == cur.File && prev.Codec == cur.Codec && prev.RestartRows == cur.RestartRows
+			})
+			if idx < 0 || previous[idx].Error != "" || previous[idx].RawBytes == 0 {
+				continue
+			}
+			prev := previous[idx]
+			name := cur.File
+			if name == "" {
+				name = "total"
+			}
+			config := cur.Codec
+			if cur.RestartRows != 0 {
+				config = fmt.Sprintf("%s and -restartrows %d", cur.Codec, cur.RestartRows)
+			}
+			switch {
+			case cur.Error != "":
+				regressions = append(regressions, fmt.Sprintf("%s with %s: %s", name, config, cur.Error))
+			case cur.Ratio > prev.Ratio*(1+tolerance):
+				regressions = append(regressions, fmt.Sprintf("%s with %s: ratio %.4f, was %.4f", name, config, cur.Ratio, prev.Ratio))
+			}
+		}
+	}
+	compare(report.Results, baseline.Results)
+	compare(report.Totals, baseline.Totals)
+	return regressions
+}
@@ -0,0 +1,53 @@
+package codingmethods
+
+import "github.com/Kagamiin/pixcrumb/cmd/imgtools"
+
+// entropy_stats.json is the output of crumbhist -format json over testdata/corpus; see testdata/corpus/README.md.
+//
+//go:generate go run ../../analysistools/genentropy -out entropy.go entropy_stats.json
+
+const order1DictMaxCodeLength = 12
+
+// ConditionalBitDicts holds one prefix code per previous crumb.
+type ConditionalBitDicts [16]BitDict
+
+// BuildConditionalBitDicts builds order-1 prefix codes out of crumb transition counts.
+func BuildConditionalBitDicts(transitions [16][16]uint64, maxLength uint) (ConditionalBitDicts, error) {
+	var result ConditionalBitDicts
+	for prev, freqs := range transitions {
+		dict, err := BuildCanonicalBitDict(freqs[:], maxLength)
+		if err != nil {
+			return result, err
+		}
+		result[prev] = dict
+	}
+	return result, nil
+}
+
+// DictsOrder1 are the built-in order-1 literal tables, built from crumbTransitionHistogram.
+var DictsOrder1 = func() ConditionalBitDicts {
+	dicts, err := BuildConditionalBitDicts(crumbTransitionHistogram, order1DictMaxCodeLength)
+	if err != nil {
+		panic(err)
+	}
+	return dicts
+}()
+
+type bitDictWord struct {
+	value  uint64
+	length uint
+}
+
+func (w bitDictWord) Value() uint64 {
+	return w.value
+}
+
+func (w bitDictWord) Length() uint {
+	return w.length
+}
+
+type BitDict map[imgtools.Crumb]bitDictWord
+
+const (
+	TOKEN_END_OF_LITERALS imgtools.Crumb = 16
+)
@@ -1,11 +1,14 @@
 package codingmethods
 
 import (
+	"errors"
 	"io"
 
 	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
 )
 
+var ErrExpGolombOverflow = errors.New("exp-Golomb coded number does not fit in 16 bits")
+
 type bitstreamMSB struct {
 	data          *[]byte
 	bytePosition  int
@@ -114,7 +117,7 @@ func (b *bitstreamMSB) ReadBits(count uint) (res uint64, err error) {
 }
 
 func (b *bitstreamMSB) PokeBit(bit uint8) {
-	(*b.data)[b.bytePosition] &= ^uint8(0x80) >> b.bitPosition
+	(*b.data)[b.bytePosition] &= ^(uint8(0x80) >> b.bitPosition)
 	(*b.data)[b.bytePosition] |= (bit & 0x01) << (7 - b.bitPosition)
 }
 
@@ -185,7 +188,7 @@ func (b *bitstreamMSB) writeOrder0ExpGolombNumber16(value uint16) {
 func (b *bitstreamMSB) WriteOrderKExpGolombNumber16(value uint16, order uint16) {
 	b.writeOrder0ExpGolombNumber16(value >> order)
 	if order > 0 {
-		b.WriteBits(uint64(value&(order-1)), uint(order))
+		b.WriteBits(uint64(value&(1<<order-1)), uint(order))
 	}
 }
 
@@ -206,6 +209,9 @@ func (b *bitstreamMSB) ReadOrderKExpGolombNumber16(order uint16) (uint16, error)
 	}
 	for bit == 0 {
 		leadingBitCount++
+		if leadingBitCount > 15 {
+			return 0, ErrExpGolombOverflow
+		}
 		bit, err = b.ReadBit()
 		if err != nil {
 			return 0, err
@@ -213,5 +219,12 @@ func (b *bitstreamMSB) ReadOrderKExpGolombNumber16(order uint16) (uint16, error)
 	}
 	trailingBitCount := leadingBitCount + order
 	suffix, err := b.ReadBits(uint(trailingBitCount))
-	return uint16(suffix + (1 << (trailingBitCount)) - 1), err
+	if err != nil {
+		return 0, err
+	}
+	value := suffix + 1<<trailingBitCount - 1<<order
+	if value > 0xFFFF {
+		return 0, ErrExpGolombOverflow
+	}
+	return uint16(value), nil
 }
@@ -0,0 +1,116 @@
+package codingmethods
+
+import (
+	"errors"
+
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+// contextModeledCrumbCoder codes every crumb with the adaptive range coder, as a 4-level binary tree whose
+// probabilities are picked by the previous crumb (in CrumbReader order) and the crumb directly above.
+type contextModeledCrumbCoder struct {
+	crumbReader CrumbReader
+	encoder     *rangeEncoder
+	codeWriter  BitstreamMSBWriter
+
+	decoder     *rangeDecoder
+	codeReader  BitstreamMSBReader
+	crumbWriter CrumbWriter
+
+	probs     []rcProb
+	lastCrumb imgtools.Crumb
+}
+
+const crumbTreeSize = 16
+
+func NewContextModeledCrumbCoder(
+	encSrc CrumbReader,
+	encDest BitstreamMSBWriter,
+
+	decSrc BitstreamMSBReader,
+	decDest CrumbWriter,
+) (FlushingCodingMethod, error) {
+	if (encSrc == nil) != (encDest == nil) {
+		return nil, errors.New("encode source supplied without a destination (or vice-versa)")
+	}
+	if (decSrc == nil) != (decDest == nil) {
+		return nil, errors.New("decode source supplied without a destination (or vice-versa)")
+	}
+	result := &contextModeledCrumbCoder{
+		crumbReader: encSrc,
+		codeWriter:  encDest,
+		codeReader:  decSrc,
+		crumbWriter: decDest,
+		probs:       newRCProbs(16 * 16 * crumbTreeSize),
+	}
+	if encDest != nil {
+		result.encoder = newRangeEncoder(encDest)
+	}
+	if decSrc != nil {
+		result.decoder = newRangeDecoder(decSrc)
+	}
+	return result, nil
+}
+
+var _ FlushingCodingMethod = &contextModeledCrumbCoder{}
+
+func (cmc *contextModeledCrumbCoder) contextProbs(peeker CrumbPeeker) []rcProb {
+	var above imgtools.Crumb
+	if y, x := peeker.TellCoords(); y > 0 {
+		above, _ = peeker.PeekCrumbAtCoords(y-1, x)
+	}
+	ctx := (int(cmc.lastCrumb)*16 + int(above)) * crumbTreeSize
+	return cmc.probs[ctx : ctx+crumbTreeSize]
+}
+
+// EncodeSome encodes crumbs up to the end of the current crumb row.
+func (cmc *contextModeledCrumbCoder) EncodeSome() (nCrumbs uint64, bitsWritten uint64, err error) {
+	if cmc.crumbReader == nil || cmc.codeWriter == nil {
+		panic("tried to encode without having supplied encoding source/destination")
+	}
+	startPos := cmc.codeWriter.Tell()
+	width := cmc.crumbReader.GetWidthCrumbs()
+	for !cmc.crumbReader.IsAtEnd() {
+		probs := cmc.contextProbs(cmc.crumbReader)
+		c, err := cmc.crumbReader.ReadCrumb()
+		if err != nil {
+			return 0, 0, err
+		}
+		cmc.encoder.encodeBitTree(probs, 4, uint32(c))
+		cmc.lastCrumb = c
+		nCrumbs++
+		if uint64(cmc.crumbReader.Tell())%width == 0 {
+			break
+		}
+	}
+	return nCrumbs, uint64(cmc.codeWriter.Tell() - startPos), nil
+}
+
+func (cmc *contextModeledCrumbCoder) Flush() (bitsWritten uint64, err error) {
+	if cmc.encoder == nil {
+		panic("tried to flush without having supplied encoding destination")
+	}
+	startPos := cmc.codeWriter.Tell()
+	cmc.encoder.flush()
+	return uint64(cmc.codeWriter.Tell() - startPos), nil
+}
+
+// DecodeSome decodes crumbs up to the end of the current crumb row.
+func (cmc *contextModeledCrumbCoder) DecodeSome() (nCrumbs uint64, bitsRead uint64, err error) {
+	if cmc.codeReader == nil || cmc.crumbWriter == nil {
+		panic("tried to decode without having supplied decoding source/destination")
+	}
+	startPos := cmc.codeReader.Tell()
+	width := cmc.crumbWriter.GetWidthCrumbs()
+	for {
+		probs := cmc.contextProbs(cmc.crumbWriter)
+		c := imgtools.Crumb(cmc.decoder.decodeBitTree(probs, 4))
+		cmc.crumbWriter.WriteCrumb(c)
+		cmc.lastCrumb = c
+		nCrumbs++
+		if uint64(cmc.crumbWriter.Tell())%width == 0 {
+			break
+		}
+	}
+	return nCrumbs, uint64(cmc.codeReader.Tell() - startPos), nil
+}
@@ -90,13 +90,20 @@ func (ci *crumbIterator) linearToMortonIndex(idx int64) (yPos int, xPos int) {
 	return
 }
 
+func (ci *crumbIterator) TellCoords() (yPos int, xPos int) {
+	return ci.linearToMortonIndex(ci.index)
+}
+
+func (ci *crumbIterator) GetWidthCrumbs() uint64 {
+	return ci.width
+}
+
 func (ci *crumbIterator) GetHeightCrumbs() int {
 	return len(*ci.mtx)
 }
 
 func (ci *crumbIterator) IsLengthAligned() bool {
-	_, x := ci.linearToMortonIndex(int64(ci.totalDataLen))
-	return x == 0
+	return ci.totalDataLen%ci.width == 0
 }
 
 func (ci *crumbIterator) IsAtEnd() bool {
@@ -134,6 +141,13 @@ func (ci *crumbIterator) PeekCrumbAt(offset int64, relative bool) (imgtools.Crum
 	return (*ci.mtx)[y][x], nil
 }
 
+func (ci *crumbIterator) PeekCrumbAtCoords(yPos int, xPos int) (imgtools.Crumb, error) {
+	if yPos < 0 || xPos < 0 || yPos >= len(*ci.mtx) || xPos >= int(ci.width) {
+		return 0, fmt.Errorf("%w (tried to access coordinates %d,%d (size %dx%d))", ErrCrumbIndexOutOfBounds, xPos, yPos, ci.width, len(*ci.mtx))
+	}
+	return (*ci.mtx)[yPos][xPos], nil
+}
+
 func (ci *crumbIterator) PeekCrumb() (c imgtools.Crumb, err error) {
 	return ci.PeekCrumbAt(ci.index, false)
 }
@@ -184,6 +198,9 @@ func (ci *crumbIterator) WriteCrumb(c imgtools.Crumb) {
 	}
 	(*ci.mtx)[y][x] = c
 	ci.index++
+	if ci.index > int64(ci.totalDataLen) {
+		ci.totalDataLen = uint64(ci.index)
+	}
 }
 
 func (ci *crumbIterator) WriteCrumbs(cList []imgtools.Crumb) {
@@ -191,3 +208,18 @@ func (ci *crumbIterator) WriteCrumbs(cList []imgtools.Crumb) {
 		ci.WriteCrumb(c)
 	}
 }
+
+// Truncate drops everything written past the first length crumbs. It only shortens the matrix by whole rows, so length
+// must be a multiple of the width.
+func (ci *crumbIterator) Truncate(length uint64) error {
+	if length%ci.width != 0 {
+		return ErrCrumbDataNotAlignedToMatrix
+	}
+	if length >= ci.totalDataLen {
+		return nil
+	}
+	*ci.mtx = (*ci.mtx)[:length/ci.width]
+	ci.totalDataLen = length
+	ci.index = min(ci.index, int64(length))
+	return nil
+}
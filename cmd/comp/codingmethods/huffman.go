@@ -0,0 +1,165 @@
+package codingmethods
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+// Canonical, length-limited prefix codes for crumb alphabets.
+
+const MaxBitDictCodeLength = 15
+
+// BuildCanonicalBitDict builds a canonical prefix code for symbols 0 to len(freqs)-1 with no code longer than maxLength
+// bits. Every symbol gets a code, even if its frequency is zero.
+func BuildCanonicalBitDict(freqs []uint64, maxLength uint) (BitDict, error) {
+	n := len(freqs)
+	if n < 2 {
+		return nil, errors.New("cannot build a prefix code for less than 2 symbols")
+	}
+	if maxLength > MaxBitDictCodeLength || 1<<maxLength < n {
+		return nil, fmt.Errorf("cannot build a prefix code for %d symbols with a max length of %d bits", n, maxLength)
+	}
+	lengths := huffmanCodeLengths(freqs)
+	limitCodeLengths(lengths, freqs, maxLength)
+	return canonicalBitDict(lengths), nil
+}
+
+// huffmanCodeLengths computes plain Huffman code lengths, with zero frequencies bumped to one.
+func huffmanCodeLengths(freqs []uint64) []uint {
+	type node struct {
+		weight  uint64
+		symbols []int
+	}
+	nodes := make([]node, len(freqs))
+	for i, f := range freqs {
+		nodes[i] = node{weight: max(f, 1), symbols: []int{i}}
+	}
+	lengths := make([]uint, len(freqs))
+	for len(nodes) > 1 {
+		// Stable sort keeps the result independent of anything but the frequencies.
+		slices.SortStableFunc(nodes, func(a, b node) int {
+			if a.weight != b.weight {
+				if a.weight < b.weight {
+					return -1
+				}
+				return 1
+			}
+			return len(a.symbols) - len(b.symbols)
+		})
+		merged := node{
+			weight:  nodes[0].weight + nodes[1].weight,
+			symbols: append(append([]int(nil), nodes[0].symbols...), nodes[1].symbols...),
+		}
+		for _, s := range merged.symbols {
+			lengths[s]++
+		}
+		nodes = append([]node{merged}, nodes[2:]...)
+	}
+	return lengths
+}
+
+// limitCodeLengths clamps code lengths to maxLength, then lengthens the least frequent codes that are still short
+// until the Kraft inequality holds again.
+func limitCodeLengths(lengths []uint, freqs []uint64, maxLength uint) {
+	for i := range lengths {
+		lengths[i] = min(lengths[i], maxLength)
+	}
+	kraft := func() (sum uint64) {
+		for _, l := range lengths {
+			sum += 1 << (maxLength - l)
+		}
+		return
+	}
+	order := make([]int, len(lengths))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		if freqs[a] != freqs[b] {
+			if freqs[a] < freqs[b] {
+				return -1
+			}
+			return 1
+		}
+		return b - a
+	})
+	for kraft() > 1<<maxLength {
+		for _, s := range order {
+			if lengths[s] < maxLength {
+				lengths[s]++
+				break
+			}
+		}
+	}
+}
+
+func canonicalBitDict(lengths []uint) BitDict {
+	order := make([]int, len(lengths))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return int(lengths[a]) - int(lengths[b])
+	})
+	result := make(BitDict, len(lengths))
+	var code uint64
+	var prevLength uint
+	for _, s := range order {
+		code <<= lengths[s] - prevLength
+		prevLength = lengths[s]
+		result[imgtools.Crumb(s)] = bitDictWord{value: code, length: lengths[s]}
+		code++
+	}
+	return result
+}
+
+// bitDictDecoder decodes canonical prefix codes with per-length lookup tables.
+type bitDictDecoder struct {
+	firstCode   [MaxBitDictCodeLength + 1]uint64
+	count       [MaxBitDictCodeLength + 1]uint64
+	firstSymbol [MaxBitDictCodeLength + 1]int
+	symbols     []imgtools.Crumb
+	maxLength   uint
+}
+
+func newBitDictDecoder(dict BitDict) *bitDictDecoder {
+	var result bitDictDecoder
+	for s, w := range dict {
+		result.symbols = append(result.symbols, s)
+		result.count[w.length]++
+		result.maxLength = max(result.maxLength, w.length)
+	}
+	slices.SortFunc(result.symbols, func(a, b imgtools.Crumb) int {
+		if la, lb := dict[a].length, dict[b].length; la != lb {
+			return int(la) - int(lb)
+		}
+		return int(dict[a].value) - int(dict[b].value)
+	})
+	symbolIdx := 0
+	for l := uint(1); l <= result.maxLength; l++ {
+		result.firstSymbol[l] = symbolIdx
+		if result.count[l] > 0 {
+			result.firstCode[l] = dict[result.symbols[symbolIdx]].value
+		}
+		symbolIdx += int(result.count[l])
+	}
+	return &result
+}
+
+func (d *bitDictDecoder) decode(reader BitstreamMSBReader) (c imgtools.Crumb, nBits uint, err error) {
+	var code uint64
+	for l := uint(1); l <= d.maxLength; l++ {
+		bit, err := reader.ReadBit()
+		if err != nil {
+			return 0, l - 1, err
+		}
+		code = code<<1 | uint64(bit)
+		if d.count[l] > 0 && code >= d.firstCode[l] && code-d.firstCode[l] < d.count[l] {
+			return d.symbols[d.firstSymbol[l]+int(code-d.firstCode[l])], l, nil
+		}
+	}
+	return 0, d.maxLength, errors.New("invalid prefix code in bitstream")
+}
@@ -7,14 +7,24 @@ type CodingMethod interface {
 	DecodeSome() (nCrumbs uint64, bitsRead uint64, err error)
 }
 
+// FlushingCodingMethod is a CodingMethod that buffers state while encoding, which must be flushed once the
+// whole input has been encoded.
+type FlushingCodingMethod interface {
+	CodingMethod
+	Flush() (bitsWritten uint64, err error)
+}
+
 type CrumbPeeker interface {
 	Length() uint64
 	Seek(offset int64, whence int) (int64, error)
 	Tell() int64
+	TellCoords() (yPos int, xPos int)
+	GetWidthCrumbs() uint64
 	PeekCrumb() (imgtools.Crumb, error)
 	PeekNCrumbs(n uint64) ([]imgtools.Crumb, error)
 	PeekCrumbAt(offset int64, relative bool) (imgtools.Crumb, error)
 	PeekNCrumbsAt(n uint64, offset int64, relative bool) ([]imgtools.Crumb, error)
+	PeekCrumbAtCoords(yPos int, xPos int) (imgtools.Crumb, error)
 	IsLengthAligned() bool
 	IsAtEnd() bool
 	GetHeightCrumbs() int
@@ -30,6 +40,7 @@ type CrumbWriter interface {
 	CrumbPeeker
 	WriteCrumb(c imgtools.Crumb)
 	WriteCrumbs(cList []imgtools.Crumb)
+	Truncate(length uint64) error
 }
 
 type CrumbReadWriter interface {
@@ -56,21 +56,27 @@ func (clc *zeroTerminated4BitCrumbLiteralCoder) EncodeSome() (nCrumbs uint64, bi
 	return uint64(len(cList)) - 1, uint64(len(cList)) * 4, nil
 }
 
+// DecodeSome decodes one literal run. The zero crumb that terminates it is written out as well, but isn't counted in
+// nCrumbs, matching EncodeSome.
 func (clc *zeroTerminated4BitCrumbLiteralCoder) DecodeSome() (nCrumbs uint64, bitsRead uint64, err error) {
 	if clc.literalReader == nil || clc.crumbWriter == nil {
 		panic("tried to encode without having supplied encoding source/destination")
 	}
 	var cList []imgtools.Crumb
-	for clc.literalReader.BitsLeft() > 4 {
+	for clc.literalReader.BitsLeft() >= 4 {
 		c, err := clc.literalReader.ReadBits(4)
 		if err != nil {
 			return 0, 0, err
 		}
+		bitsRead += 4
+		cList = append(cList, imgtools.Crumb(c))
 		if c == 0 {
 			break
 		}
-		cList = append(cList, imgtools.Crumb(c))
 	}
 	clc.crumbWriter.WriteCrumbs(cList)
-	return uint64(len(cList)), uint64(len(cList)+1) * 4, nil
+	if len(cList) > 0 && cList[len(cList)-1] == 0 {
+		return uint64(len(cList)) - 1, bitsRead, nil
+	}
+	return uint64(len(cList)), bitsRead, nil
 }
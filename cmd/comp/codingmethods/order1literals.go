@@ -0,0 +1,118 @@
+package codingmethods
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+// order1HuffmanCrumbLiteralCoder is a drop-in replacement for zeroTerminated4BitCrumbLiteralCoder: literals run up
+// to and including a terminating zero crumb, but each crumb is coded with the prefix code selected by the crumb
+// before it.
+type order1HuffmanCrumbLiteralCoder struct {
+	crumbReader   CrumbReader
+	literalWriter BitstreamMSBWriter
+
+	literalReader BitstreamMSBReader
+	crumbWriter   CrumbWriter
+
+	dicts    ConditionalBitDicts
+	decoders [16]*bitDictDecoder
+}
+
+// NewOrder1HuffmanCrumbLiteralCoder creates an order-1 literal coder. If dicts is nil, DictsOrder1 is used.
+func NewOrder1HuffmanCrumbLiteralCoder(
+	encSrc CrumbReader,
+	encDest BitstreamMSBWriter,
+
+	decSrc BitstreamMSBReader,
+	decDest CrumbWriter,
+
+	dicts *ConditionalBitDicts,
+) (CodingMethod, error) {
+	if (encSrc == nil) != (encDest == nil) {
+		return nil, errors.New("encode source supplied without a destination (or vice-versa)")
+	}
+	if (decSrc == nil) != (decDest == nil) {
+		return nil, errors.New("decode source supplied without a destination (or vice-versa)")
+	}
+	if dicts == nil {
+		dicts = &DictsOrder1
+	}
+	result := &order1HuffmanCrumbLiteralCoder{
+		crumbReader:   encSrc,
+		literalWriter: encDest,
+		literalReader: decSrc,
+		crumbWriter:   decDest,
+		dicts:         *dicts,
+	}
+	for prev, dict := range result.dicts {
+		if len(dict) != 16 {
+			return nil, fmt.Errorf("literal table %d has %d entries, expected 16", prev, len(dict))
+		}
+		result.decoders[prev] = newBitDictDecoder(dict)
+	}
+	return result, nil
+}
+
+var _ CodingMethod = &order1HuffmanCrumbLiteralCoder{}
+
+// previousCrumb returns the crumb before the current position, or zero at the start of the plane.
+func previousCrumb(peeker CrumbPeeker) imgtools.Crumb {
+	if peeker.Tell() == 0 {
+		return 0
+	}
+	c, _ := peeker.PeekCrumbAt(-1, true)
+	return c
+}
+
+func (olc *order1HuffmanCrumbLiteralCoder) EncodeSome() (nCrumbs uint64, bitsWritten uint64, err error) {
+	if olc.crumbReader == nil || olc.literalWriter == nil {
+		panic("tried to encode without having supplied encoding source/destination")
+	}
+	prev := previousCrumb(olc.crumbReader)
+	for !olc.crumbReader.IsAtEnd() {
+		c, err := olc.crumbReader.ReadCrumb()
+		if err != nil {
+			return 0, 0, err
+		}
+		word := olc.dicts[prev][c]
+		olc.literalWriter.WriteDictEntry(word)
+		bitsWritten += uint64(word.length)
+		if c == 0 {
+			break
+		}
+		nCrumbs++
+		prev = c
+	}
+	return nCrumbs, bitsWritten, nil
+}
+
+// DecodeSome decodes one literal run. The zero crumb that terminates it is written out as well, but isn't counted in
+// nCrumbs, matching EncodeSome.
+func (olc *order1HuffmanCrumbLiteralCoder) DecodeSome() (nCrumbs uint64, bitsRead uint64, err error) {
+	if olc.literalReader == nil || olc.crumbWriter == nil {
+		panic("tried to decode without having supplied decoding source/destination")
+	}
+	prev := previousCrumb(olc.crumbWriter)
+	for olc.literalReader.BitsLeft() > 0 {
+		c, nBits, err := olc.decoders[prev].decode(olc.literalReader)
+		bitsRead += uint64(nBits)
+		if errors.Is(err, io.EOF) {
+			// only padding was left at the end of the stream
+			break
+		}
+		if err != nil {
+			return nCrumbs, bitsRead, err
+		}
+		olc.crumbWriter.WriteCrumb(c)
+		if c == 0 {
+			break
+		}
+		nCrumbs++
+		prev = c
+	}
+	return nCrumbs, bitsRead, nil
+}
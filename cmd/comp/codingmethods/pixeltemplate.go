@@ -0,0 +1,140 @@
+package codingmethods
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+// pixelTemplateCoder codes a bitplane pixel by pixel with the adaptive range coder, in the style of JBIG generic
+// regions: the probability of each pixel comes from a template of already-coded neighbors.
+type pixelTemplateCoder struct {
+	pixelReader *imgtools.Bitplane
+	encoder     *rangeEncoder
+	codeWriter  BitstreamMSBWriter
+
+	decoder     *rangeDecoder
+	codeReader  BitstreamMSBReader
+	pixelWriter *imgtools.Bitplane
+
+	template [][2]int
+	probs    []rcProb
+	row      uint64
+}
+
+// Template pixel offsets as {dx, dy}, all of which are causal (above, or to the left on the current row).
+var (
+	// JBIG 3-line template
+	pixelTemplate10 = [][2]int{
+		{-1, -2}, {0, -2}, {1, -2},
+		{-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {2, -1},
+		{-2, 0}, {-1, 0},
+	}
+	// JBIG2 generic region template 0, with the adaptive pixels at their default positions
+	pixelTemplate16 = [][2]int{
+		{-2, -2}, {-1, -2}, {0, -2}, {1, -2}, {2, -2},
+		{-3, -1}, {-2, -1}, {-1, -1}, {0, -1}, {1, -1}, {2, -1}, {3, -1},
+		{-4, 0}, {-3, 0}, {-2, 0}, {-1, 0},
+	}
+)
+
+func NewPixelTemplateCoder(
+	encSrc *imgtools.Bitplane,
+	encDest BitstreamMSBWriter,
+
+	decSrc BitstreamMSBReader,
+	decDest *imgtools.Bitplane,
+
+	templateSize int,
+) (FlushingCodingMethod, error) {
+	if (encSrc == nil) != (encDest == nil) {
+		return nil, errors.New("encode source supplied without a destination (or vice-versa)")
+	}
+	if (decSrc == nil) != (decDest == nil) {
+		return nil, errors.New("decode source supplied without a destination (or vice-versa)")
+	}
+	var template [][2]int
+	switch templateSize {
+	case 10:
+		template = pixelTemplate10
+	case 16:
+		template = pixelTemplate16
+	default:
+		return nil, fmt.Errorf("unsupported pixel template size %d (must be 10 or 16)", templateSize)
+	}
+	result := &pixelTemplateCoder{
+		pixelReader: encSrc,
+		codeWriter:  encDest,
+		codeReader:  decSrc,
+		pixelWriter: decDest,
+		template:    template,
+		probs:       newRCProbs(1 << len(template)),
+	}
+	if encDest != nil {
+		result.encoder = newRangeEncoder(encDest)
+	}
+	if decSrc != nil {
+		result.decoder = newRangeDecoder(decSrc)
+	}
+	return result, nil
+}
+
+var _ FlushingCodingMethod = &pixelTemplateCoder{}
+
+func (ptc *pixelTemplateCoder) context(bp *imgtools.Bitplane, x uint64) int {
+	ctx := 0
+	for _, offs := range ptc.template {
+		px, py := int64(x)+int64(offs[0]), int64(ptc.row)+int64(offs[1])
+		ctx <<= 1
+		if px >= 0 && py >= 0 && px < int64(bp.GetWidthPx()) {
+			ctx |= int(bp.GetPixel(uint64(px), uint64(py)))
+		}
+	}
+	return ctx
+}
+
+// EncodeSome encodes one row of pixels. nCrumbs counts pixels for this coder.
+func (ptc *pixelTemplateCoder) EncodeSome() (nCrumbs uint64, bitsWritten uint64, err error) {
+	if ptc.pixelReader == nil || ptc.codeWriter == nil {
+		panic("tried to encode without having supplied encoding source/destination")
+	}
+	if ptc.row >= ptc.pixelReader.GetHeightPx() {
+		return 0, 0, nil
+	}
+	startPos := ptc.codeWriter.Tell()
+	for x := range ptc.pixelReader.GetWidthPx() {
+		ctx := ptc.context(ptc.pixelReader, x)
+		ptc.encoder.encodeBit(&ptc.probs[ctx], ptc.pixelReader.GetPixel(x, ptc.row))
+		nCrumbs++
+	}
+	ptc.row++
+	return nCrumbs, uint64(ptc.codeWriter.Tell() - startPos), nil
+}
+
+func (ptc *pixelTemplateCoder) Flush() (bitsWritten uint64, err error) {
+	if ptc.encoder == nil {
+		panic("tried to flush without having supplied encoding destination")
+	}
+	startPos := ptc.codeWriter.Tell()
+	ptc.encoder.flush()
+	return uint64(ptc.codeWriter.Tell() - startPos), nil
+}
+
+// DecodeSome decodes one row of pixels. nCrumbs counts pixels for this coder.
+func (ptc *pixelTemplateCoder) DecodeSome() (nCrumbs uint64, bitsRead uint64, err error) {
+	if ptc.codeReader == nil || ptc.pixelWriter == nil {
+		panic("tried to decode without having supplied decoding source/destination")
+	}
+	if ptc.row >= ptc.pixelWriter.GetHeightPx() {
+		return 0, 0, nil
+	}
+	startPos := ptc.codeReader.Tell()
+	for x := range ptc.pixelWriter.GetWidthPx() {
+		ctx := ptc.context(ptc.pixelWriter, x)
+		ptc.pixelWriter.SetPixel(x, ptc.row, ptc.decoder.decodeBit(&ptc.probs[ctx]))
+		nCrumbs++
+	}
+	ptc.row++
+	return nCrumbs, uint64(ptc.codeReader.Tell() - startPos), nil
+}
@@ -0,0 +1,150 @@
+package codingmethods
+
+// Adaptive binary range coder in the style of LZMA's: probabilities are 11-bit estimates of a bit being zero, adapted
+// by 1/32 of the error after every coded bit. Output is byte-oriented and goes through the MSB-first bitstream.
+
+const (
+	rcProbBits       = 11
+	rcProbInit       = 1 << (rcProbBits - 1)
+	rcProbMax        = 1 << rcProbBits
+	rcAdaptShift     = 5
+	rcTopValue       = 1 << 24
+	rcInitBytes      = 5
+	rcMaxFlushShifts = 5
+)
+
+type rcProb uint16
+
+func newRCProbs(n int) []rcProb {
+	probs := make([]rcProb, n)
+	for i := range probs {
+		probs[i] = rcProbInit
+	}
+	return probs
+}
+
+type rangeEncoder struct {
+	out       BitstreamMSBWriter
+	low       uint64
+	rng       uint32
+	cache     uint8
+	cacheSize int64
+}
+
+func newRangeEncoder(out BitstreamMSBWriter) *rangeEncoder {
+	return &rangeEncoder{
+		out:       out,
+		rng:       0xFFFFFFFF,
+		cacheSize: 1,
+	}
+}
+
+func (rc *rangeEncoder) shiftLow() {
+	if uint32(rc.low) < 0xFF000000 || rc.low>>32 != 0 {
+		carry := uint8(rc.low >> 32)
+		temp := rc.cache
+		for {
+			rc.out.WriteBits(uint64(temp+carry), 8)
+			temp = 0xFF
+			rc.cacheSize--
+			if rc.cacheSize == 0 {
+				break
+			}
+		}
+		rc.cache = uint8(rc.low >> 24)
+	}
+	rc.cacheSize++
+	rc.low = (rc.low & 0x00FFFFFF) << 8
+}
+
+func (rc *rangeEncoder) encodeBit(prob *rcProb, bit uint8) {
+	bound := (rc.rng >> rcProbBits) * uint32(*prob)
+	if bit == 0 {
+		rc.rng = bound
+		*prob += (rcProbMax - *prob) >> rcAdaptShift
+	} else {
+		rc.low += uint64(bound)
+		rc.rng -= bound
+		*prob -= *prob >> rcAdaptShift
+	}
+	for rc.rng < rcTopValue {
+		rc.rng <<= 8
+		rc.shiftLow()
+	}
+}
+
+func (rc *rangeEncoder) flush() {
+	for range rcMaxFlushShifts {
+		rc.shiftLow()
+	}
+}
+
+type rangeDecoder struct {
+	in          BitstreamMSBReader
+	code        uint32
+	rng         uint32
+	initialized bool
+}
+
+func newRangeDecoder(in BitstreamMSBReader) *rangeDecoder {
+	return &rangeDecoder{
+		in:  in,
+		rng: 0xFFFFFFFF,
+	}
+}
+
+// readByte returns zeroes past the end of the stream, which is what the encoder's flush implicitly assumes.
+func (rc *rangeDecoder) readByte() uint8 {
+	if rc.in.BitsLeft() < 8 {
+		return 0
+	}
+	b, _ := rc.in.ReadBits(8)
+	return uint8(b)
+}
+
+func (rc *rangeDecoder) init() {
+	for range rcInitBytes {
+		rc.code = rc.code<<8 | uint32(rc.readByte())
+	}
+	rc.initialized = true
+}
+
+func (rc *rangeDecoder) decodeBit(prob *rcProb) uint8 {
+	if !rc.initialized {
+		rc.init()
+	}
+	var bit uint8
+	bound := (rc.rng >> rcProbBits) * uint32(*prob)
+	if rc.code < bound {
+		rc.rng = bound
+		*prob += (rcProbMax - *prob) >> rcAdaptShift
+	} else {
+		rc.code -= bound
+		rc.rng -= bound
+		*prob -= *prob >> rcAdaptShift
+		bit = 1
+	}
+	for rc.rng < rcTopValue {
+		rc.rng <<= 8
+		rc.code = rc.code<<8 | uint32(rc.readByte())
+	}
+	return bit
+}
+
+// encodeBitTree codes the lowest numBits bits of value MSB first, using a binary tree of 1 << numBits probabilities.
+func (rc *rangeEncoder) encodeBitTree(probs []rcProb, numBits uint, value uint32) {
+	node := uint32(1)
+	for i := int(numBits) - 1; i >= 0; i-- {
+		bit := uint8(value>>i) & 0x01
+		rc.encodeBit(&probs[node], bit)
+		node = node<<1 | uint32(bit)
+	}
+}
+
+func (rc *rangeDecoder) decodeBitTree(probs []rcProb, numBits uint) uint32 {
+	node := uint32(1)
+	for range numBits {
+		node = node<<1 | uint32(rc.decodeBit(&probs[node]))
+	}
+	return node - (1 << numBits)
+}
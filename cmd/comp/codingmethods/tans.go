@@ -0,0 +1,323 @@
+package codingmethods
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+// Table-based asymmetric numeral system (tANS/FSE) coder for crumbs. Nonzero crumbs are coded as literal symbols and
+// zero runs as run-length tokens, grouped in power-of-two buckets followed by the low bits of the length. Symbol
+// frequencies are measured on the encoded data and stored in a header at the start of the stream.
+
+const (
+	tansNumLiteralSymbols = 15
+	tansNumRunBuckets     = 16
+	tansNumSymbols        = tansNumLiteralSymbols + tansNumRunBuckets
+	tansMaxRunLength      = 1<<tansNumRunBuckets - 1
+	tansMinTableLog       = 5
+	tansMaxTableLog       = 11
+	tansTableLogBits      = 4
+)
+
+var ErrTANSStreamInvalid = errors.New("invalid tANS stream")
+
+type tansToken struct {
+	symbol    uint8
+	extraBits uint64
+	numExtra  uint
+}
+
+func tansRunToken(runLength uint64) tansToken {
+	bucket := uint(bits.Len64(runLength)) - 1
+	return tansToken{
+		symbol:    uint8(tansNumLiteralSymbols + bucket),
+		extraBits: runLength - 1<<bucket,
+		numExtra:  bucket,
+	}
+}
+
+type tansDecodeEntry struct {
+	symbol   uint8
+	numBits  uint
+	newState uint32
+}
+
+type tansTable struct {
+	tableLog uint
+	counts   [tansNumSymbols]uint32
+	// encoding: successor states of each symbol, indexed by (state >> numBits) - count
+	encStates [tansNumSymbols][]uint32
+	decode    []tansDecodeEntry
+}
+
+// normalizeTANSCounts scales symbol frequencies to sum to 1 << tableLog, keeping every present symbol at least 1.
+func normalizeTANSCounts(freqs [tansNumSymbols]uint64, tableLog uint) [tansNumSymbols]uint32 {
+	var result [tansNumSymbols]uint32
+	var total uint64
+	for _, f := range freqs {
+		total += f
+	}
+	tableSize := int64(1) << tableLog
+	var sum int64
+	largest := 0
+	for s, f := range freqs {
+		if f == 0 {
+			continue
+		}
+		result[s] = uint32(max(1, (f*uint64(tableSize)+total/2)/total))
+		sum += int64(result[s])
+		if f > freqs[largest] {
+			largest = s
+		}
+	}
+	// Rounding errors go to (or come from) the most frequent symbols first.
+	for sum != tableSize {
+		if sum < tableSize {
+			result[largest]++
+			sum++
+			continue
+		}
+		best := -1
+		for s := range result {
+			if result[s] > 1 && (best < 0 || result[s] > result[best]) {
+				best = s
+			}
+		}
+		result[best]--
+		sum--
+	}
+	return result
+}
+
+func newTANSTable(counts [tansNumSymbols]uint32, tableLog uint) (*tansTable, error) {
+	tableSize := uint32(1) << tableLog
+	var sum uint32
+	for _, c := range counts {
+		sum += c
+	}
+	if sum != tableSize {
+		return nil, fmt.Errorf("%w: symbol counts add up to %d instead of %d", ErrTANSStreamInvalid, sum, tableSize)
+	}
+
+	t := &tansTable{
+		tableLog: tableLog,
+		counts:   counts,
+		decode:   make([]tansDecodeEntry, tableSize),
+	}
+
+	// Spread symbols over the table the same way FSE does.
+	spread := make([]uint8, tableSize)
+	step := tableSize>>1 + tableSize>>3 + 3
+	pos := uint32(0)
+	for s, c := range counts {
+		for range c {
+			spread[pos] = uint8(s)
+			pos = (pos + step) & (tableSize - 1)
+		}
+	}
+
+	var next [tansNumSymbols]uint32
+	for s, c := range counts {
+		next[s] = c
+		t.encStates[s] = make([]uint32, 0, c)
+	}
+	for x := range tableSize {
+		s := spread[x]
+		y := next[s]
+		next[s]++
+		numBits := tableLog - uint(bits.Len32(y)-1)
+		t.decode[x] = tansDecodeEntry{
+			symbol:   s,
+			numBits:  numBits,
+			newState: y<<numBits - tableSize,
+		}
+		t.encStates[s] = append(t.encStates[s], x+tableSize)
+	}
+	return t, nil
+}
+
+// tansCrumbCoder buffers tokens while encoding, since ANS has to encode them in reverse; everything is written out
+// on Flush.
+type tansCrumbCoder struct {
+	crumbReader CrumbReader
+	codeWriter  BitstreamMSBWriter
+	tokens      []tansToken
+
+	codeReader  BitstreamMSBReader
+	crumbWriter CrumbWriter
+	table       *tansTable
+	state       uint32
+}
+
+func NewTANSCrumbCoder(
+	encSrc CrumbReader,
+	encDest BitstreamMSBWriter,
+
+	decSrc BitstreamMSBReader,
+	decDest CrumbWriter,
+) (FlushingCodingMethod, error) {
+	if (encSrc == nil) != (encDest == nil) {
+		return nil, errors.New("encode source supplied without a destination (or vice-versa)")
+	}
+	if (decSrc == nil) != (decDest == nil) {
+		return nil, errors.New("decode source supplied without a destination (or vice-versa)")
+	}
+	return &tansCrumbCoder{
+		crumbReader: encSrc,
+		codeWriter:  encDest,
+		codeReader:  decSrc,
+		crumbWriter: decDest,
+	}, nil
+}
+
+var _ FlushingCodingMethod = &tansCrumbCoder{}
+
+// EncodeSome reads one token's worth of crumbs: either a single nonzero crumb or a run of zeros. Nothing is written
+// until Flush.
+func (tc *tansCrumbCoder) EncodeSome() (nCrumbs uint64, bitsWritten uint64, err error) {
+	if tc.crumbReader == nil || tc.codeWriter == nil {
+		panic("tried to encode without having supplied encoding source/destination")
+	}
+	if tc.crumbReader.IsAtEnd() {
+		return 0, 0, nil
+	}
+	c, err := tc.crumbReader.ReadCrumb()
+	if err != nil {
+		return 0, 0, err
+	}
+	if c != 0 {
+		tc.tokens = append(tc.tokens, tansToken{symbol: uint8(c - 1)})
+		return 1, 0, nil
+	}
+	nCrumbs = 1
+	for !tc.crumbReader.IsAtEnd() && nCrumbs < tansMaxRunLength {
+		c, err := tc.crumbReader.PeekCrumb()
+		if err != nil {
+			return 0, 0, err
+		}
+		if c != 0 {
+			break
+		}
+		tc.crumbReader.ReadCrumb()
+		nCrumbs++
+	}
+	tc.tokens = append(tc.tokens, tansRunToken(nCrumbs))
+	return nCrumbs, 0, nil
+}
+
+func chooseTANSTableLog(numTokens int) uint {
+	return max(tansMinTableLog, min(tansMaxTableLog, uint(bits.Len(uint(numTokens)))))
+}
+
+func (tc *tansCrumbCoder) Flush() (bitsWritten uint64, err error) {
+	if tc.codeWriter == nil {
+		panic("tried to flush without having supplied encoding destination")
+	}
+	if len(tc.tokens) == 0 {
+		return 0, nil
+	}
+	startPos := tc.codeWriter.Tell()
+
+	var freqs [tansNumSymbols]uint64
+	for _, tok := range tc.tokens {
+		freqs[tok.symbol]++
+	}
+	tableLog := chooseTANSTableLog(len(tc.tokens))
+	table, err := newTANSTable(normalizeTANSCounts(freqs, tableLog), tableLog)
+	if err != nil {
+		return 0, err
+	}
+
+	// Encode backwards, remembering the state bits each token pushes out.
+	type chunk struct {
+		value   uint32
+		numBits uint
+	}
+	chunks := make([]chunk, len(tc.tokens))
+	tableSize := uint32(1) << tableLog
+	state := tableSize
+	for i := len(tc.tokens) - 1; i >= 0; i-- {
+		s := tc.tokens[i].symbol
+		count := table.counts[s]
+		numBits := uint(0)
+		for state>>numBits >= 2*count {
+			numBits++
+		}
+		chunks[i] = chunk{value: state & (1<<numBits - 1), numBits: numBits}
+		state = table.encStates[s][state>>numBits-count]
+	}
+
+	tc.codeWriter.WriteBits(uint64(tableLog), tansTableLogBits)
+	for _, c := range table.counts {
+		tc.codeWriter.WriteOrderKExpGolombNumber16(uint16(c), 0)
+	}
+	tc.codeWriter.WriteBits(uint64(state-tableSize), tableLog)
+	for i, tok := range tc.tokens {
+		tc.codeWriter.WriteBits(tok.extraBits, tok.numExtra)
+		tc.codeWriter.WriteBits(uint64(chunks[i].value), chunks[i].numBits)
+	}
+	tc.tokens = nil
+	return uint64(tc.codeWriter.Tell() - startPos), nil
+}
+
+func (tc *tansCrumbCoder) readHeader() error {
+	tableLog, err := tc.codeReader.ReadBits(tansTableLogBits)
+	if err != nil {
+		return err
+	}
+	if tableLog < tansMinTableLog || tableLog > tansMaxTableLog {
+		return fmt.Errorf("%w: table log %d", ErrTANSStreamInvalid, tableLog)
+	}
+	var counts [tansNumSymbols]uint32
+	for s := range counts {
+		c, err := tc.codeReader.ReadOrderKExpGolombNumber16(0)
+		if err != nil {
+			return err
+		}
+		counts[s] = uint32(c)
+	}
+	tc.table, err = newTANSTable(counts, uint(tableLog))
+	if err != nil {
+		return err
+	}
+	state, err := tc.codeReader.ReadBits(uint(tableLog))
+	tc.state = uint32(state)
+	return err
+}
+
+// DecodeSome decodes a single token.
+func (tc *tansCrumbCoder) DecodeSome() (nCrumbs uint64, bitsRead uint64, err error) {
+	if tc.codeReader == nil || tc.crumbWriter == nil {
+		panic("tried to decode without having supplied decoding source/destination")
+	}
+	startPos := tc.codeReader.Tell()
+	if tc.table == nil {
+		if err := tc.readHeader(); err != nil {
+			return 0, uint64(tc.codeReader.Tell() - startPos), err
+		}
+	}
+
+	entry := tc.table.decode[tc.state]
+	if entry.symbol < tansNumLiteralSymbols {
+		tc.crumbWriter.WriteCrumb(imgtools.Crumb(entry.symbol + 1))
+		nCrumbs = 1
+	} else {
+		bucket := uint(entry.symbol - tansNumLiteralSymbols)
+		extra, err := tc.codeReader.ReadBits(bucket)
+		if err != nil {
+			return 0, uint64(tc.codeReader.Tell() - startPos), err
+		}
+		nCrumbs = 1<<bucket + extra
+		tc.crumbWriter.WriteCrumbs(make([]imgtools.Crumb, nCrumbs))
+	}
+
+	stateBits, err := tc.codeReader.ReadBits(entry.numBits)
+	if err != nil {
+		return nCrumbs, uint64(tc.codeReader.Tell() - startPos), err
+	}
+	tc.state = entry.newState + uint32(stateBits)
+	return nCrumbs, uint64(tc.codeReader.Tell() - startPos), nil
+}
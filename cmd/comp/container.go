@@ -0,0 +1,267 @@
+package comp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+)
+
+// Containers bundle the compressed bitplanes of several images, such as the frames of an animation, together with
+// what a decoder needs to put them back together. They are IFF files of type PXCB, made of these chunks:
+//
+//   - PHDR: u16 width, u16 height, u8 color bitplanes per frame, u8 flags (bit 0: mask), then the abbreviated name
+//     of the codec the bitplanes are compressed with. Frames of a container with the mask flag hold one more bitplane,
+//     first, which is a transparency mask set for opaque pixels; it is delta-encoded and compressed like the others.
+//   - CMAP: the palette, as 8-bit RGB triples (optional)
+//   - FRAM, one per frame: u8 flags (bit 0: keyframe), u8 reserved, u16 reference frame, u16 display time in
+//     1/100 s, then a u32 size and the blob of each bitplane. The bitplanes of a frame that isn't a keyframe were
+//     XORed with those of its reference frame before being compressed.
+//   - TMAP: a tilemap, when the frame is a tileset: u16 width and u16 height in tiles, u16 number of tiles in the
+//     tileset, u8 coding of the entries (0: raw 16-bit words, 1: compressed with the tilemap codec), u8 reserved, then
+//     the coded entries. Tileset images are laid out as a grid of 8x8 tiles, numbered left to right, top to bottom.
+//
+// All numbers are big-endian, as usual for IFF, raw tilemap words included, and chunks are padded to an even length.
+
+const (
+	containerFormType = "PXCB"
+
+	ContainerMask = 1 << 0
+
+	ContainerFrameKeyframe = 1 << 0
+
+	// tilemap entries as big-endian 16-bit words: tile index in bits 0-13, horizontal flip in bit 14 and
+	// vertical flip in bit 15
+	ContainerTilemapWords = 0
+	// tilemap entries coded with CompressTilemap
+	ContainerTilemapCompressed = 1
+
+	// maxContainerChunkSize bounds any chunk: a frame can't hold more than 16 maximum-sized blobs, plus a mask.
+	maxContainerChunkSize = 17*(MaxBlobSize+4) + 6
+)
+
+var ErrContainerInvalid = errors.New("invalid container data")
+
+type ContainerFrame struct {
+	Flags uint8
+	// index of the frame this one was XORed with; only meaningful for frames that aren't keyframes
+	Reference int
+	DelayCs   int
+	// marshaled blob of each bitplane, starting with the mask in containers that have one
+	Planes [][]byte
+}
+
+func (f *ContainerFrame) IsKeyframe() bool {
+	return f.Flags&ContainerFrameKeyframe != 0
+}
+
+type ContainerTilemap struct {
+	WidthTiles, HeightTiles int
+	NumTiles                int
+	Coding                  uint8
+	Data                    []byte
+}
+
+type Container struct {
+	Width, Height int
+	// number of color bitplanes, not counting the mask
+	NumPlanes int
+	Flags     uint8
+	CodecName string
+	Palette   color.Palette
+	Frames    []ContainerFrame
+	// nil unless the frames are tilesets
+	Tilemap *ContainerTilemap
+}
+
+func (c *Container) HasMask() bool {
+	return c.Flags&ContainerMask != 0
+}
+
+// NumFramePlanes returns the number of bitplanes stored in each frame, including the mask.
+func (c *Container) NumFramePlanes() int {
+	if c.HasMask() {
+		return c.NumPlanes + 1
+	}
+	return c.NumPlanes
+}
+
+func writeContainerChunk(dest *bytes.Buffer, id string, data []byte) {
+	dest.WriteString(id)
+	dest.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+	dest.Write(data)
+	if len(data)&1 != 0 {
+		dest.WriteByte(0)
+	}
+}
+
+func (c *Container) Marshal() ([]byte, error) {
+	if c.Width > 0xFFFF || c.Height > 0xFFFF || c.NumPlanes < 1 || c.NumPlanes > 16 {
+		return nil, fmt.Errorf("cannot store %dx%d images with %d bitplanes in a container", c.Width, c.Height, c.NumPlanes)
+	}
+	var body bytes.Buffer
+	body.WriteString(containerFormType)
+
+	var header bytes.Buffer
+	header.Write(binary.BigEndian.AppendUint16(nil, uint16(c.Width)))
+	header.Write(binary.BigEndian.AppendUint16(nil, uint16(c.Height)))
+	header.WriteByte(uint8(c.NumPlanes))
+	header.WriteByte(c.Flags)
+	header.WriteString(c.CodecName)
+	writeContainerChunk(&body, "PHDR", header.Bytes())
+
+	if c.Palette != nil {
+		var cmap []byte
+		for _, col := range c.Palette {
+			rgba := color.RGBAModel.Convert(col).(color.RGBA)
+			cmap = append(cmap, rgba.R, rgba.G, rgba.B)
+		}
+		writeContainerChunk(&body, "CMAP", cmap)
+	}
+
+	for i, frame := range c.Frames {
+		if len(frame.Planes) != c.NumFramePlanes() {
+			return nil, fmt.Errorf("frame %d has %d bitplanes, expected %d", i, len(frame.Planes), c.NumFramePlanes())
+		}
+		if !frame.IsKeyframe() && (frame.Reference < 0 || frame.Reference >= i) {
+			return nil, fmt.Errorf("frame %d references frame %d, which doesn't come before it", i, frame.Reference)
+		}
+		if frame.Reference > 0xFFFF || frame.DelayCs < 0 || frame.DelayCs > 0xFFFF {
+			return nil, fmt.Errorf("cannot store frame %d with reference %d and delay %d in a container", i, frame.Reference, frame.DelayCs)
+		}
+		var chunk bytes.Buffer
+		chunk.WriteByte(frame.Flags)
+		chunk.WriteByte(0)
+		chunk.Write(binary.BigEndian.AppendUint16(nil, uint16(frame.Reference)))
+		chunk.Write(binary.BigEndian.AppendUint16(nil, uint16(frame.DelayCs)))
+		for _, plane := range frame.Planes {
+			chunk.Write(binary.BigEndian.AppendUint32(nil, uint32(len(plane))))
+			chunk.Write(plane)
+		}
+		writeContainerChunk(&body, "FRAM", chunk.Bytes())
+	}
+
+	if tm := c.Tilemap; tm != nil {
+		if tm.WidthTiles > 0xFFFF || tm.HeightTiles > 0xFFFF || tm.WidthTiles*tm.HeightTiles > MaxTilemapWords || tm.NumTiles > 0xFFFF {
+			return nil, fmt.Errorf("cannot store a %dx%d tilemap of %d tiles in a container", tm.WidthTiles, tm.HeightTiles, tm.NumTiles)
+		}
+		var chunk bytes.Buffer
+		chunk.Write(binary.BigEndian.AppendUint16(nil, uint16(tm.WidthTiles)))
+		chunk.Write(binary.BigEndian.AppendUint16(nil, uint16(tm.HeightTiles)))
+		chunk.Write(binary.BigEndian.AppendUint16(nil, uint16(tm.NumTiles)))
+		chunk.WriteByte(tm.Coding)
+		chunk.WriteByte(0)
+		chunk.Write(tm.Data)
+		writeContainerChunk(&body, "TMAP", chunk.Bytes())
+	}
+
+	var result bytes.Buffer
+	writeContainerChunk(&result, "FORM", body.Bytes())
+	return result.Bytes(), nil
+}
+
+func (c *Container) Unmarshal(data []byte) error {
+	if len(data) < 12 || string(data[0:4]) != "FORM" || string(data[8:12]) != containerFormType {
+		return fmt.Errorf("%w: not a %s file", ErrContainerInvalid, containerFormType)
+	}
+	formSize := binary.BigEndian.Uint32(data[4:8])
+	if formSize < 4 || uint64(formSize) > uint64(len(data)-8) {
+		return fmt.Errorf("%w: FORM size %d is past the end of the data", ErrContainerInvalid, formSize)
+	}
+	data = data[12 : 8+formSize]
+
+	*c = Container{}
+	hasHeader := false
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return fmt.Errorf("%w: truncated chunk header", ErrContainerInvalid)
+		}
+		id := string(data[0:4])
+		size := binary.BigEndian.Uint32(data[4:8])
+		if size > maxContainerChunkSize || uint64(size) > uint64(len(data)-8) {
+			return fmt.Errorf("%w: chunk '%s' has invalid size %d", ErrContainerInvalid, id, size)
+		}
+		chunk := data[8 : 8+size]
+		data = data[min(8+uint64(size)+uint64(size&1), uint64(len(data))):]
+
+		if id != "PHDR" && !hasHeader {
+			return fmt.Errorf("%w: chunk '%s' comes before the PHDR chunk", ErrContainerInvalid, id)
+		}
+		switch id {
+		case "PHDR":
+			if hasHeader {
+				return fmt.Errorf("%w: more than one PHDR chunk", ErrContainerInvalid)
+			}
+			if len(chunk) < 6 {
+				return fmt.Errorf("%w: PHDR chunk is too short", ErrContainerInvalid)
+			}
+			c.Width = int(binary.BigEndian.Uint16(chunk[0:2]))
+			c.Height = int(binary.BigEndian.Uint16(chunk[2:4]))
+			c.NumPlanes = int(chunk[4])
+			c.Flags = chunk[5]
+			c.CodecName = string(chunk[6:])
+			if c.NumPlanes < 1 || c.NumPlanes > 16 {
+				return fmt.Errorf("%w: %d bitplanes per frame", ErrContainerInvalid, c.NumPlanes)
+			}
+			hasHeader = true
+		case "CMAP":
+			c.Palette = make(color.Palette, len(chunk)/3)
+			for i := range c.Palette {
+				c.Palette[i] = color.RGBA{chunk[i*3], chunk[i*3+1], chunk[i*3+2], 0xFF}
+			}
+		case "FRAM":
+			frame, err := c.unmarshalFrame(chunk, len(c.Frames))
+			if err != nil {
+				return err
+			}
+			c.Frames = append(c.Frames, frame)
+		case "TMAP":
+			if len(chunk) < 8 {
+				return fmt.Errorf("%w: TMAP chunk is too short", ErrContainerInvalid)
+			}
+			c.Tilemap = &ContainerTilemap{
+				WidthTiles:  int(binary.BigEndian.Uint16(chunk[0:2])),
+				HeightTiles: int(binary.BigEndian.Uint16(chunk[2:4])),
+				NumTiles:    int(binary.BigEndian.Uint16(chunk[4:6])),
+				Coding:      chunk[6],
+				Data:        bytes.Clone(chunk[8:]),
+			}
+			if numWords := c.Tilemap.WidthTiles * c.Tilemap.HeightTiles; numWords > MaxTilemapWords {
+				return fmt.Errorf("%w: %dx%d tilemap has more than %d entries", ErrContainerInvalid, c.Tilemap.WidthTiles, c.Tilemap.HeightTiles, MaxTilemapWords)
+			}
+		}
+		// unknown chunks are skipped
+	}
+	if !hasHeader {
+		return fmt.Errorf("%w: no PHDR chunk", ErrContainerInvalid)
+	}
+	return nil
+}
+
+func (c *Container) unmarshalFrame(chunk []byte, index int) (ContainerFrame, error) {
+	if len(chunk) < 6 {
+		return ContainerFrame{}, fmt.Errorf("%w: frame %d: FRAM chunk is too short", ErrContainerInvalid, index)
+	}
+	frame := ContainerFrame{
+		Flags:     chunk[0],
+		Reference: int(binary.BigEndian.Uint16(chunk[2:4])),
+		DelayCs:   int(binary.BigEndian.Uint16(chunk[4:6])),
+	}
+	if !frame.IsKeyframe() && frame.Reference >= index {
+		return ContainerFrame{}, fmt.Errorf("%w: frame %d references frame %d, which doesn't come before it", ErrContainerInvalid, index, frame.Reference)
+	}
+	chunk = chunk[6:]
+	for p := range c.NumFramePlanes() {
+		if len(chunk) < 4 {
+			return ContainerFrame{}, fmt.Errorf("%w: frame %d: truncated before BP%d", ErrContainerInvalid, index, p)
+		}
+		size := binary.BigEndian.Uint32(chunk[0:4])
+		if size > MaxBlobSize || uint64(size) > uint64(len(chunk)-4) {
+			return ContainerFrame{}, fmt.Errorf("%w: frame %d: BP%d has invalid size %d", ErrContainerInvalid, index, p, size)
+		}
+		frame.Planes = append(frame.Planes, bytes.Clone(chunk[4:4+size]))
+		chunk = chunk[4+size:]
+	}
+	return frame, nil
+}
@@ -0,0 +1,171 @@
+package comp
+
+import (
+	"errors"
+	"image/color"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+// seedPlanes are small bitplanes of different sizes and contents, used to build the seed corpus of the fuzz targets.
+var seedPlanes = []struct {
+	width, height uint64
+	bitAt         func(x, y uint64) uint8
+}{
+	{8, 2, func(x, y uint64) uint8 { return 0 }},
+	{1, 1, func(x, y uint64) uint8 { return 1 }},
+	{17, 13, func(x, y uint64) uint8 { return uint8((x/2 + y/2) % 2) }},
+	{40, 24, func(x, y uint64) uint8 {
+		h := uint32(x*73856093) ^ uint32(y*19349663)
+		h ^= h >> 13
+		return uint8(h>>5) & 1
+	}},
+}
+
+// compressSeedPlanes returns the marshaled blobs of seedPlanes, delta-encoded and compressed with the named codec.
+func compressSeedPlanes(tb testing.TB, codecName string) [][]byte {
+	tb.Helper()
+	var blobs [][]byte
+	for _, sp := range seedPlanes {
+		codec, err := NewPixCrumbCodecByName(codecName)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		bp := imgtools.NewBitplane(sp.width, sp.height)
+		for y := range sp.height {
+			for x := range sp.width {
+				bp.SetPixel(x, y, sp.bitAt(x, y))
+			}
+		}
+		bp.DeltaEncode()
+		blob, err := codec.Compress(imgtools.BitplaneToCrumbPlane(bp))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		data, err := blob.Marshal()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		blobs = append(blobs, data)
+	}
+	return blobs
+}
+
+// FuzzUnmarshalDecompress feeds arbitrary blobs to every codec's decoder, which must return an error instead of
+// panicking on bad data. codecIndex selects the codec among GetPixCrumbCodecNames.
+func FuzzUnmarshalDecompress(f *testing.F) {
+	codecNames := GetPixCrumbCodecNames()
+	for i, codecName := range codecNames {
+		for _, data := range compressSeedPlanes(f, codecName) {
+			f.Add(uint8(i), data)
+		}
+	}
+	f.Fuzz(func(t *testing.T, codecIndex uint8, data []byte) {
+		codec, err := NewPixCrumbCodecByName(codecNames[int(codecIndex)%len(codecNames)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		blob := codec.NewBlob()
+		if err := blob.Unmarshal(data); err != nil {
+			return
+		}
+		if err := codec.LoadBlob(blob); err != nil {
+			return
+		}
+		crp, err := codec.Decompress()
+		if err != nil {
+			return
+		}
+		if crp.GetWidthCrumbs() != uint64(blob.GetWidthTiles())*4 || crp.GetHeightCrumbs() != uint64(blob.GetHeightCrumbs()) {
+			t.Fatalf("decoded a %dx%d crumb plane from a blob of %d tiles by %d crumb rows", crp.GetWidthCrumbs(), crp.GetHeightCrumbs(), blob.GetWidthTiles(), blob.GetHeightCrumbs())
+		}
+	})
+}
+
+// FuzzDecompressTilemap checks that the tilemap decoder rejects bad data with an error, and that whatever it accepts
+// compresses back to the same words.
+func FuzzDecompressTilemap(f *testing.F) {
+	seeds := [][]uint16{
+		{0},
+		{0, 1, 2, 3, 4, 5, 6, 7},
+		{5, 5, 5, 5, 0x4005, 0x8005, 0xC005, 6},
+		{0x3FFF, 0, 0x3FFF, 1, 1, 2},
+	}
+	for _, words := range seeds {
+		f.Add(CompressTilemap(words), uint16(len(words)))
+	}
+	f.Fuzz(func(t *testing.T, data []byte, numWords uint16) {
+		words, err := DecompressTilemap(data, int(numWords))
+		if err != nil {
+			return
+		}
+		if len(words) != int(numWords) {
+			t.Fatalf("decoded %d words, expected %d", len(words), numWords)
+		}
+		again, err := DecompressTilemap(CompressTilemap(words), len(words))
+		if err != nil {
+			t.Fatalf("decoding recompressed tilemap: %s", err)
+		}
+		if !slices.Equal(again, words) {
+			t.Fatal("recompressed tilemap decodes to different words")
+		}
+	})
+}
+
+// FuzzContainerUnmarshal checks that Container.Unmarshal rejects bad data with an error, and that whatever it accepts
+// survives being marshaled and unmarshaled again.
+func FuzzContainerUnmarshal(f *testing.F) {
+	blobs := compressSeedPlanes(f, "pcrle")
+	seeds := []Container{
+		{
+			Width: 40, Height: 24, NumPlanes: 1, CodecName: "pcrle",
+			Palette: color.Palette{color.RGBA{0, 0, 0, 0xFF}, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}},
+			Frames:  []ContainerFrame{{Flags: ContainerFrameKeyframe, DelayCs: 10, Planes: blobs[3:]}},
+		},
+		{
+			Width: 8, Height: 2, NumPlanes: 1, Flags: ContainerMask, CodecName: "pcrle",
+			Frames: []ContainerFrame{
+				{Flags: ContainerFrameKeyframe, Planes: [][]byte{blobs[0], blobs[0]}},
+				{Reference: 0, DelayCs: 5, Planes: [][]byte{blobs[0], blobs[0]}},
+			},
+		},
+		{
+			Width: 8, Height: 8, NumPlanes: 1, CodecName: "pcrle",
+			Frames: []ContainerFrame{{Flags: ContainerFrameKeyframe, Planes: blobs[:1]}},
+			Tilemap: &ContainerTilemap{
+				WidthTiles: 4, HeightTiles: 2, NumTiles: 1, Coding: ContainerTilemapCompressed,
+				Data: CompressTilemap([]uint16{0, 0, 0x4000, 0, 0, 0x8000, 0, 0}),
+			},
+		},
+	}
+	for _, c := range seeds {
+		data, err := c.Marshal()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var c Container
+		if err := c.Unmarshal(data); err != nil {
+			if !errors.Is(err, ErrContainerInvalid) {
+				t.Fatalf("error does not wrap ErrContainerInvalid: %s", err)
+			}
+			return
+		}
+		remarshaled, err := c.Marshal()
+		if err != nil {
+			t.Fatalf("marshaling an unmarshaled container: %s", err)
+		}
+		var again Container
+		if err := again.Unmarshal(remarshaled); err != nil {
+			t.Fatalf("unmarshaling a remarshaled container: %s", err)
+		}
+		if !reflect.DeepEqual(again, c) {
+			t.Fatal("container changed after being marshaled and unmarshaled again")
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package comp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp/codingmethods"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+var ErrInvalidStepSize = errors.New("incremental decoding step must produce at least one crumb")
+
+// PixCrumbStreamingDecoder is implemented by decoders that can decode the loaded blob a little at a time.
+type PixCrumbStreamingDecoder interface {
+	PixCrumbDecoder
+	NewIncrementalDecoder() (*IncrementalDecoder, error)
+}
+
+// IncrementalDecoder decodes a plane in bounded pieces, keeping its position in the blob's streams between calls, so
+// that decoding can be spread out over time.
+//
+// Crumbs come out in scan order: the serpentine order of CrumbReader, which starts over left-to-right at every
+// restart point.
+//
+// Only the decoding work is spread out, not the memory: the coding methods read earlier crumbs back as context, so the
+// CrumbWriter they decode into keeps every crumb decoded so far, up to the whole plane (or, in codecs with restart
+// points, the whole restart segment), even after Step has returned them.
+type IncrementalDecoder struct {
+	widthCrumbs uint64
+	heightRows  int
+	// crumb row where decoding started
+	firstRow        int
+	restartInterval int
+
+	// decodeSome runs the codec for one DecodeSome call, returning the crumbs it produced
+	decodeSome func() ([]imgtools.Crumb, error)
+	// crumbs decoded but not returned yet
+	pending []imgtools.Crumb
+	// crumbs of the current row returned so far, in scan order
+	row     []imgtools.Crumb
+	emitted int64
+	err     error
+}
+
+func newIncrementalDecoder(widthCrumbs uint64, heightRows, firstRow, restartInterval int, decodeSome func() ([]imgtools.Crumb, error)) *IncrementalDecoder {
+	return &IncrementalDecoder{
+		widthCrumbs:     widthCrumbs,
+		heightRows:      heightRows,
+		firstRow:        firstRow,
+		restartInterval: restartInterval,
+		decodeSome:      decodeSome,
+	}
+}
+
+// newCrumbWriterSource wraps the DecodeSome method of a coding method that decodes into crumbWriter, returning only the
+// crumbs each call adds. Anything past totalCrumbs is dropped.
+func newCrumbWriterSource(decodeSome func() (uint64, uint64, error), crumbWriter codingmethods.CrumbWriter, totalCrumbs int64) func() ([]imgtools.Crumb, error) {
+	return func() ([]imgtools.Crumb, error) {
+		start := crumbWriter.Tell()
+		if _, _, err := decodeSome(); err != nil {
+			return nil, err
+		}
+		n := min(crumbWriter.Tell(), totalCrumbs) - start
+		if n <= 0 {
+			return nil, nil
+		}
+		return crumbWriter.PeekNCrumbsAt(uint64(n), start, false)
+	}
+}
+
+func (d *IncrementalDecoder) GetWidthCrumbs() uint64 {
+	return d.widthCrumbs
+}
+
+// GetRow returns the index of the crumb row the next crumb belongs to, counted from the top of the plane.
+func (d *IncrementalDecoder) GetRow() int {
+	return d.firstRow + int(d.emitted/int64(d.widthCrumbs))
+}
+
+// Tell returns the number of crumbs returned so far.
+func (d *IncrementalDecoder) Tell() int64 {
+	return d.emitted
+}
+
+func (d *IncrementalDecoder) IsDone() bool {
+	return d.GetRow() >= d.heightRows
+}
+
+// Step returns up to maxCrumbs crumbs in scan order, decoding only as much as it takes to produce them. It returns
+// io.EOF once the whole plane has been returned, and ErrInvalidStepSize if maxCrumbs isn't positive.
+func (d *IncrementalDecoder) Step(maxCrumbs int) ([]imgtools.Crumb, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if maxCrumbs <= 0 {
+		return nil, fmt.Errorf("%w (got %d)", ErrInvalidStepSize, maxCrumbs)
+	}
+	remaining := int64(d.heightRows-d.firstRow)*int64(d.widthCrumbs) - d.emitted
+	if remaining <= 0 {
+		return nil, io.EOF
+	}
+	n := int(min(int64(maxCrumbs), remaining))
+	// A single call may legitimately produce nothing (e.g. a zero run of length zero), but not two in a row.
+	emptyCalls := 0
+	for len(d.pending) < n {
+		crumbs, err := d.decodeSome()
+		if err != nil {
+			d.err = err
+			return nil, err
+		}
+		if len(crumbs) == 0 {
+			emptyCalls++
+			if emptyCalls > 1 {
+				d.err = fmt.Errorf("%w: decoder stopped producing crumbs at crumb row %d", ErrBlobDataInconsistent, d.GetRow())
+				return nil, d.err
+			}
+			continue
+		}
+		emptyCalls = 0
+		d.pending = append(d.pending, crumbs...)
+	}
+
+	result := slices.Clone(d.pending[:n])
+	d.pending = d.pending[n:]
+	for _, c := range result {
+		d.row = append(d.row, c)
+		if uint64(len(d.row)) == d.widthCrumbs {
+			d.row = d.row[:0]
+		}
+	}
+	d.emitted += int64(n)
+	return result, nil
+}
+
+// NextRow finishes decoding the current crumb row and returns all of it, left to right. It returns io.EOF once the
+// whole plane has been returned.
+func (d *IncrementalDecoder) NextRow() ([]imgtools.Crumb, error) {
+	row := d.GetRow()
+	partial := slices.Clone(d.row)
+	rest, err := d.Step(int(d.widthCrumbs) - len(partial))
+	if err != nil {
+		return nil, err
+	}
+	result := append(partial, rest...)
+	if d.isRowReversed(row) {
+		slices.Reverse(result)
+	}
+	return result, nil
+}
+
+// isRowReversed tells whether a crumb row is scanned right-to-left.
+func (d *IncrementalDecoder) isRowReversed(row int) bool {
+	if d.restartInterval != 0 {
+		row %= d.restartInterval
+	}
+	return row&1 != 0
+}
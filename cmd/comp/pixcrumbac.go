@@ -0,0 +1,198 @@
+package comp
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp/codingmethods"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+const (
+	pcACName       = "pixcrumb-ac"
+	pcACAbbrevName = "pcac"
+)
+
+type pixCrumbACBlob struct {
+	heightCrumbs uint8
+	widthTiles   uint8
+	dataStream   []byte
+}
+
+var _ PixCrumbBlob = &pixCrumbACBlob{}
+
+func (b *pixCrumbACBlob) GetTotalSize() uint64 {
+	return uint64(len(b.dataStream) + 2)
+}
+
+func (b *pixCrumbACBlob) GetHeightCrumbs() uint8 {
+	return b.heightCrumbs
+}
+
+func (b *pixCrumbACBlob) GetWidthTiles() uint8 {
+	return b.widthTiles
+}
+
+func (b *pixCrumbACBlob) Marshal() ([]byte, error) {
+	writer := bytes.NewBuffer(make([]byte, 0, b.GetTotalSize()))
+	writer.WriteByte(b.heightCrumbs)
+	writer.WriteByte(b.widthTiles)
+	writer.Write(b.dataStream)
+	return writer.Bytes(), nil
+}
+
+func (b *pixCrumbACBlob) Unmarshal(data []byte) error {
+	if err := checkBlobSize(data, 2); err != nil {
+		return err
+	}
+	b.heightCrumbs = data[0]
+	b.widthTiles = data[1]
+	b.dataStream = append([]byte(nil), data[2:]...)
+	return nil
+}
+
+type pixCrumbACState struct {
+	blob  pixCrumbACBlob
+	trace []DecodeCheckpoint
+}
+
+var _ PixCrumbCodec = &pixCrumbACState{}
+var _ PixCrumbTracingDecoder = &pixCrumbACState{}
+var _ PixCrumbStreamingDecoder = &pixCrumbACState{}
+
+func NewPixCrumbACEncoder() PixCrumbEncoder {
+	return &pixCrumbACState{}
+}
+
+func NewPixCrumbACDecoder(pcBlob PixCrumbBlob) (PixCrumbDecoder, error) {
+	var result pixCrumbACState
+	if err := result.LoadBlob(pcBlob); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func NewPixCrumbAC() PixCrumbCodec {
+	return &pixCrumbACState{}
+}
+
+func (s *pixCrumbACState) GetName() string {
+	return pcACName
+}
+
+func (s *pixCrumbACState) GetAbbrevName() string {
+	return pcACAbbrevName
+}
+
+func (s *pixCrumbACState) NewBlob() PixCrumbBlob {
+	return &pixCrumbACBlob{}
+}
+
+func (s *pixCrumbACState) GetDecodeTrace() []DecodeCheckpoint {
+	return s.trace
+}
+
+func (s *pixCrumbACState) LoadBlob(pcBlob PixCrumbBlob) error {
+	if b, ok := pcBlob.(*pixCrumbACBlob); !ok {
+		return fmt.Errorf("cannot load blob into PixCrumbAC: %w", ErrWrongBlogTypeForCodec)
+	} else {
+		s.blob = *b
+	}
+	return nil
+}
+
+func (s *pixCrumbACState) Compress(crp *imgtools.CrumbPlane) (blob PixCrumbBlob, err error) {
+	wb := crp.GetWidthBpBytes()
+	h := crp.GetHeightCrumbs()
+	if wb > 255 || h > 255 {
+		return nil, fmt.Errorf("%w: rounded pixel dimensions %dx%d exceed max dimensions of 2040x510", ErrImageTooLarge, wb*8, h*2)
+	}
+	s.blob = pixCrumbACBlob{
+		heightCrumbs: uint8(h),
+		widthTiles:   uint8(wb),
+		dataStream:   make([]byte, 0),
+	}
+	dataEnc := codingmethods.NewBitstreamMSBWriter(&s.blob.dataStream)
+
+	rawData := crp.GetCrumbs()
+	crumbReader, err := codingmethods.NewCrumbReader(&rawData)
+	if err != nil {
+		return nil, err
+	}
+
+	crumbEncoder, err := codingmethods.NewContextModeledCrumbCoder(crumbReader, dataEnc, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for !crumbReader.IsAtEnd() {
+		if _, _, err := crumbEncoder.EncodeSome(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := crumbEncoder.Flush(); err != nil {
+		return nil, err
+	}
+
+	result := s.blob
+	return &result, nil
+}
+
+func (s *pixCrumbACState) Decompress() (*imgtools.CrumbPlane, error) {
+	dataDec := codingmethods.NewBitstreamMSBReader(&s.blob.dataStream)
+	widthCrumbs := uint64(s.blob.widthTiles) * 4
+	totalCrumbs := int64(widthCrumbs) * int64(s.blob.heightCrumbs)
+	if totalCrumbs == 0 {
+		return nil, fmt.Errorf("%w: blob has zero size", ErrBlobDataInvalid)
+	}
+
+	crumbWriter := codingmethods.NewCrumbWriter(widthCrumbs)
+	crumbDecoder, err := codingmethods.NewContextModeledCrumbCoder(nil, nil, dataDec, crumbWriter)
+	if err != nil {
+		return nil, err
+	}
+
+	s.trace = s.trace[:0]
+	for crumbWriter.Tell() < totalCrumbs {
+		checkpoint := DecodeCheckpoint{Stream: "data", BitOffset: dataDec.Tell()}
+		if _, _, err := crumbDecoder.DecodeSome(); err != nil {
+			return nil, newDecodeError(checkpoint.Stream, checkpoint.BitOffset, err)
+		}
+		checkpoint.Crumbs = crumbWriter.Tell()
+		s.trace = append(s.trace, checkpoint)
+	}
+
+	crumbMtx, err := crumbWriter.GetCrumbMatrix()
+	if err != nil {
+		return nil, err
+	}
+
+	return imgtools.MakeCrumbPlane(crumbMtx), nil
+}
+
+func (s *pixCrumbACState) NewIncrementalDecoder() (*IncrementalDecoder, error) {
+	widthCrumbs := uint64(s.blob.widthTiles) * 4
+	totalCrumbs := int64(widthCrumbs) * int64(s.blob.heightCrumbs)
+	if totalCrumbs == 0 {
+		return nil, fmt.Errorf("%w: blob has zero size", ErrBlobDataInvalid)
+	}
+
+	// The decoder keeps its own copy of the stream, so that loading another blob doesn't pull it from under it.
+	blob := s.blob
+	dataDec := codingmethods.NewBitstreamMSBReader(&blob.dataStream)
+	crumbWriter := codingmethods.NewCrumbWriter(widthCrumbs)
+	crumbDecoder, err := codingmethods.NewContextModeledCrumbCoder(nil, nil, dataDec, crumbWriter)
+	if err != nil {
+		return nil, err
+	}
+	source := newCrumbWriterSource(crumbDecoder.DecodeSome, crumbWriter, totalCrumbs)
+	decodeSome := func() ([]imgtools.Crumb, error) {
+		bitOffset := dataDec.Tell()
+		crumbs, err := source()
+		if err != nil {
+			return nil, newDecodeError("data", bitOffset, err)
+		}
+		return crumbs, nil
+	}
+	return newIncrementalDecoder(widthCrumbs, int(s.blob.heightCrumbs), 0, 0, decodeSome), nil
+}
@@ -2,6 +2,8 @@ package comp
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 
 	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
 )
@@ -11,8 +13,93 @@ var (
 	ErrBlobDataInvalid       = errors.New("blob data is invalid")
 	ErrBlobDataInconsistent  = errors.New("blob data has inconsistencies")
 	ErrWrongBlogTypeForCodec = errors.New("wrong blob type for this codec")
+	ErrUnknownCodec          = errors.New("unknown codec")
+	ErrBlobTooLarge          = errors.New("blob data exceeds size limit")
+	ErrNoSuchRestartPoint    = errors.New("no such restart point")
 )
 
+// MaxBlobSize is the largest blob accepted by Unmarshal. A bitplane can't be larger than 2040x510 pixels, i.e. about
+// 127 KiB uncompressed, so no sane encoding of one comes anywhere near it.
+const MaxBlobSize = 1 << 20
+
+func checkBlobSize(data []byte, minSize int) error {
+	if len(data) > MaxBlobSize {
+		return fmt.Errorf("%w: %d bytes (max %d)", ErrBlobTooLarge, len(data), MaxBlobSize)
+	}
+	if len(data) < minSize {
+		return fmt.Errorf("%w: %d bytes is too short for the header", ErrBlobDataInvalid, len(data))
+	}
+	return nil
+}
+
+// DecodeError reports where decoding a blob went wrong.
+type DecodeError struct {
+	// bitplane index, or -1 when the decoder doesn't know which plane it is working on
+	Plane     int
+	Stream    string
+	BitOffset int64
+	Err       error
+}
+
+func newDecodeError(stream string, bitOffset int64, err error) *DecodeError {
+	return &DecodeError{Plane: -1, Stream: stream, BitOffset: bitOffset, Err: err}
+}
+
+func (e *DecodeError) Error() string {
+	if e.Plane >= 0 {
+		return fmt.Sprintf("BP%d: %s stream, bit offset %d: %s", e.Plane, e.Stream, e.BitOffset, e.Err.Error())
+	}
+	return fmt.Sprintf("%s stream, bit offset %d: %s", e.Stream, e.BitOffset, e.Err.Error())
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// WithDecodePlane fills in the bitplane index of a DecodeError in err's chain. Other errors are wrapped with the
+// bitplane index instead.
+func WithDecodePlane(err error, plane int) error {
+	if err == nil {
+		return nil
+	}
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		decodeErr.Plane = plane
+		return err
+	}
+	return fmt.Errorf("BP%d: %w", plane, err)
+}
+
+var codecConstructors = map[string]func() PixCrumbCodec{
+	pcRLEAbbrevName:       NewPixCrumbRLE,
+	pcRLEOrder1AbbrevName: NewPixCrumbRLEOrder1,
+	pcACAbbrevName:        NewPixCrumbAC,
+	pcTANSAbbrevName:      NewPixCrumbTANS,
+	pcJBIGAbbrevName + "10": func() PixCrumbCodec {
+		return NewPixCrumbJBIG(10)
+	},
+	pcJBIGAbbrevName + "16": func() PixCrumbCodec {
+		return NewPixCrumbJBIG(16)
+	},
+}
+
+func NewPixCrumbCodecByName(abbrevName string) (PixCrumbCodec, error) {
+	if newCodec, ok := codecConstructors[abbrevName]; ok {
+		return newCodec(), nil
+	}
+	return nil, fmt.Errorf("%w '%s'", ErrUnknownCodec, abbrevName)
+}
+
+// GetPixCrumbCodecNames returns the abbreviated names of all known codecs, sorted.
+func GetPixCrumbCodecNames() []string {
+	var names []string
+	for name := range codecConstructors {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
 type PixCrumbBlob interface {
 	GetTotalSize() uint64
 	GetHeightCrumbs() uint8
@@ -33,10 +120,56 @@ type PixCrumbEncoder interface {
 
 type PixCrumbDecoder interface {
 	PixCrumbCodecBase
+	// NewBlob returns an empty blob of the type this decoder loads, for unmarshaling data into.
+	NewBlob() PixCrumbBlob
 	LoadBlob(PixCrumbBlob) error
 	Decompress() (*imgtools.CrumbPlane, error)
 }
 
+// DecodeCheckpoint records where in a blob's streams the crumbs produced by one decoding step came from.
+type DecodeCheckpoint struct {
+	// total number of crumbs decoded after this step, in CrumbReader order
+	Crumbs    int64
+	Stream    string
+	BitOffset int64
+}
+
+// PixCrumbTracingDecoder is implemented by decoders that keep a trace of their last Decompress call, which maps
+// crumbs back to bitstream offsets.
+type PixCrumbTracingDecoder interface {
+	PixCrumbDecoder
+	GetDecodeTrace() []DecodeCheckpoint
+}
+
+// FindDecodeCheckpoint returns the checkpoint of the decoding step that produced the crumb at crumbIdx.
+func FindDecodeCheckpoint(trace []DecodeCheckpoint, crumbIdx int64) (DecodeCheckpoint, bool) {
+	for _, cp := range trace {
+		if cp.Crumbs > crumbIdx {
+			return cp, true
+		}
+	}
+	return DecodeCheckpoint{}, false
+}
+
+// PixCrumbRestartEncoder is implemented by encoders that can split a plane into segments of a fixed number of crumb
+// rows, each coded from a fresh state, with an index of where in the blob each segment starts.
+type PixCrumbRestartEncoder interface {
+	PixCrumbEncoder
+	// SetRestartInterval sets the number of crumb rows between restart points (1-255), or disables them with 0.
+	SetRestartInterval(crumbRows int) error
+}
+
+// PixCrumbRestartDecoder is implemented by decoders that can start decoding at any restart point of a blob. A blob
+// without restart points has a single one, at its first crumb row.
+type PixCrumbRestartDecoder interface {
+	PixCrumbDecoder
+	// GetRestartInterval returns the number of crumb rows between restart points, or 0 if the blob has none.
+	GetRestartInterval() int
+	GetNumRestartPoints() int
+	// DecompressFromRestart decodes the crumb rows from the given restart point to the end of the plane.
+	DecompressFromRestart(restart int) (*imgtools.CrumbPlane, error)
+}
+
 type PixCrumbCodec interface {
 	PixCrumbEncoder
 	PixCrumbDecoder
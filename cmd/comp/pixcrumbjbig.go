@@ -0,0 +1,150 @@
+package comp
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp/codingmethods"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+// pixcrumb-jbig skips crumb coding entirely: the crumb plane is unpacked back into pixels, each of which is coded with
+// a binary arithmetic coder whose context comes from a JBIG-style causal template.
+
+const (
+	pcJBIGName       = "pixcrumb-jbig"
+	pcJBIGAbbrevName = "pcjbig"
+)
+
+type pixCrumbJBIGBlob struct {
+	heightCrumbs uint8
+	widthTiles   uint8
+	dataStream   []byte
+}
+
+var _ PixCrumbBlob = &pixCrumbJBIGBlob{}
+
+func (b *pixCrumbJBIGBlob) GetTotalSize() uint64 {
+	return uint64(len(b.dataStream) + 2)
+}
+
+func (b *pixCrumbJBIGBlob) GetHeightCrumbs() uint8 {
+	return b.heightCrumbs
+}
+
+func (b *pixCrumbJBIGBlob) GetWidthTiles() uint8 {
+	return b.widthTiles
+}
+
+func (b *pixCrumbJBIGBlob) Marshal() ([]byte, error) {
+	writer := bytes.NewBuffer(make([]byte, 0, b.GetTotalSize()))
+	writer.WriteByte(b.heightCrumbs)
+	writer.WriteByte(b.widthTiles)
+	writer.Write(b.dataStream)
+	return writer.Bytes(), nil
+}
+
+func (b *pixCrumbJBIGBlob) Unmarshal(data []byte) error {
+	if err := checkBlobSize(data, 2); err != nil {
+		return err
+	}
+	b.heightCrumbs = data[0]
+	b.widthTiles = data[1]
+	b.dataStream = append([]byte(nil), data[2:]...)
+	return nil
+}
+
+type pixCrumbJBIGState struct {
+	blob         pixCrumbJBIGBlob
+	templateSize int
+}
+
+var _ PixCrumbCodec = &pixCrumbJBIGState{}
+
+// NewPixCrumbJBIG creates a pixel template codec; templateSize is the number of context pixels (10 or 16).
+func NewPixCrumbJBIG(templateSize int) PixCrumbCodec {
+	return &pixCrumbJBIGState{templateSize: templateSize}
+}
+
+func NewPixCrumbJBIGDecoder(pcBlob PixCrumbBlob, templateSize int) (PixCrumbDecoder, error) {
+	result := pixCrumbJBIGState{templateSize: templateSize}
+	if err := result.LoadBlob(pcBlob); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *pixCrumbJBIGState) GetName() string {
+	return fmt.Sprintf("%s-%d", pcJBIGName, s.templateSize)
+}
+
+func (s *pixCrumbJBIGState) GetAbbrevName() string {
+	return fmt.Sprintf("%s%d", pcJBIGAbbrevName, s.templateSize)
+}
+
+func (s *pixCrumbJBIGState) NewBlob() PixCrumbBlob {
+	return &pixCrumbJBIGBlob{}
+}
+
+func (s *pixCrumbJBIGState) LoadBlob(pcBlob PixCrumbBlob) error {
+	if b, ok := pcBlob.(*pixCrumbJBIGBlob); !ok {
+		return fmt.Errorf("cannot load blob into PixCrumbJBIG: %w", ErrWrongBlogTypeForCodec)
+	} else {
+		s.blob = *b
+	}
+	return nil
+}
+
+func (s *pixCrumbJBIGState) Compress(crp *imgtools.CrumbPlane) (blob PixCrumbBlob, err error) {
+	wb := crp.GetWidthBpBytes()
+	h := crp.GetHeightCrumbs()
+	if wb > 255 || h > 255 {
+		return nil, fmt.Errorf("%w: rounded pixel dimensions %dx%d exceed max dimensions of 2040x510", ErrImageTooLarge, wb*8, h*2)
+	}
+	s.blob = pixCrumbJBIGBlob{
+		heightCrumbs: uint8(h),
+		widthTiles:   uint8(wb),
+		dataStream:   make([]byte, 0),
+	}
+	dataEnc := codingmethods.NewBitstreamMSBWriter(&s.blob.dataStream)
+
+	bp := imgtools.CrumbPlaneToBitplane(crp)
+	pixelEncoder, err := codingmethods.NewPixelTemplateCoder(bp, dataEnc, nil, nil, s.templateSize)
+	if err != nil {
+		return nil, err
+	}
+
+	for range bp.GetHeightPx() {
+		if _, _, err := pixelEncoder.EncodeSome(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := pixelEncoder.Flush(); err != nil {
+		return nil, err
+	}
+
+	result := s.blob
+	return &result, nil
+}
+
+func (s *pixCrumbJBIGState) Decompress() (*imgtools.CrumbPlane, error) {
+	dataDec := codingmethods.NewBitstreamMSBReader(&s.blob.dataStream)
+	if s.blob.widthTiles == 0 || s.blob.heightCrumbs == 0 {
+		return nil, fmt.Errorf("%w: blob has zero size", ErrBlobDataInvalid)
+	}
+
+	bp := imgtools.NewBitplane(uint64(s.blob.widthTiles)*8, uint64(s.blob.heightCrumbs)*2)
+	pixelDecoder, err := codingmethods.NewPixelTemplateCoder(nil, nil, dataDec, bp, s.templateSize)
+	if err != nil {
+		return nil, err
+	}
+
+	for range bp.GetHeightPx() {
+		bitOffset := dataDec.Tell()
+		if _, _, err := pixelDecoder.DecodeSome(); err != nil {
+			return nil, newDecodeError("data", bitOffset, err)
+		}
+	}
+
+	return imgtools.BitplaneToCrumbPlane(bp), nil
+}
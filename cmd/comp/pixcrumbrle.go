@@ -4,27 +4,63 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 
 	"github.com/Kagamiin/pixcrumb/cmd/comp/codingmethods"
 	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
 )
 
 const (
-	pcRLEName       = "pixcrumb-rle"
-	pcRLEAbbrevName = "pcrle"
+	pcRLEName             = "pixcrumb-rle"
+	pcRLEAbbrevName       = "pcrle"
+	pcRLEOrder1Name       = "pixcrumb-rle-order1"
+	pcRLEOrder1AbbrevName = "pcrleo1"
 )
 
 type pixCrumbRLEBlob struct {
 	heightCrumbs uint8
 	widthTiles   uint8
-	rleStream    []byte
-	dataStream   []byte
+	// crumb rows between restart points, or 0 if the blob has no restart index
+	restartInterval uint8
+	// where each segment of the plane starts, the first one included
+	restartPoints []pixCrumbRLERestartPoint
+	rleStream     []byte
+	dataStream    []byte
+}
+
+type pixCrumbRLERestartPoint struct {
+	rleBitOffset  uint32
+	dataBitOffset uint32
 }
 
 var _ PixCrumbBlob = &pixCrumbRLEBlob{}
 
+// getHeaderSize returns the size of the header, including the restart index. The first restart point is always at
+// the start of both streams, so it isn't stored.
+func (b *pixCrumbRLEBlob) getHeaderSize() int {
+	if b.restartInterval == 0 {
+		return 4
+	}
+	return 7 + 8*max(len(b.restartPoints)-1, 0)
+}
+
+// getNumSegments returns how many restart points a blob of the given height and restart interval has.
+func getNumSegments(heightCrumbs, restartInterval uint8) int {
+	if restartInterval == 0 || heightCrumbs == 0 {
+		return 1
+	}
+	return (int(heightCrumbs) + int(restartInterval) - 1) / int(restartInterval)
+}
+
+func (b *pixCrumbRLEBlob) getRestartPoints() []pixCrumbRLERestartPoint {
+	if len(b.restartPoints) == 0 {
+		return []pixCrumbRLERestartPoint{{}}
+	}
+	return b.restartPoints
+}
+
 func (b *pixCrumbRLEBlob) GetTotalSize() uint64 {
-	return uint64(len(b.rleStream) + len(b.dataStream) + 4)
+	return uint64(len(b.rleStream) + len(b.dataStream) + b.getHeaderSize())
 }
 
 func (b *pixCrumbRLEBlob) GetHeightCrumbs() uint8 {
@@ -36,42 +72,77 @@ func (b *pixCrumbRLEBlob) GetWidthTiles() uint8 {
 }
 
 func (b *pixCrumbRLEBlob) Marshal() ([]byte, error) {
-	result := make([]byte, b.GetTotalSize())
-	writer := bytes.NewBuffer(result)
+	writer := bytes.NewBuffer(make([]byte, 0, b.GetTotalSize()))
 	writer.WriteByte(b.heightCrumbs)
 	writer.WriteByte(b.widthTiles)
-	writer.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(b.rleStream)+2)))
+	if b.restartInterval != 0 {
+		// A data stream offset of zero, which is otherwise invalid, marks the extended header with the restart index.
+		writer.Write([]byte{0, 0})
+	}
+	// offset of the data stream from the start of the blob
+	writer.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(b.rleStream)+b.getHeaderSize())))
+	if b.restartInterval != 0 {
+		writer.WriteByte(b.restartInterval)
+		for _, rp := range b.getRestartPoints()[1:] {
+			writer.Write(binary.LittleEndian.AppendUint32(nil, rp.rleBitOffset))
+			writer.Write(binary.LittleEndian.AppendUint32(nil, rp.dataBitOffset))
+		}
+	}
 	writer.Write(b.rleStream)
 	writer.Write(b.dataStream)
 	if writer.Len() != int(b.GetTotalSize()) {
 		panic("number of written bytes does not match buffer size!")
 	}
-	return result, nil
+	return writer.Bytes(), nil
 }
 
 func (b *pixCrumbRLEBlob) Unmarshal(data []byte) error {
-	reader := bytes.NewBuffer(data)
-	if len(data) < 4 {
-		return ErrBlobDataInvalid
+	if err := checkBlobSize(data, 4); err != nil {
+		return err
 	}
 
-	b.heightCrumbs, _ = reader.ReadByte()
-	b.widthTiles, _ = reader.ReadByte()
-	u16le := make([]byte, 2)
-	_, _ = reader.Read(u16le)
-	dataBlobOffset := binary.LittleEndian.Uint16(u16le)
-	rleBlobLen := dataBlobOffset - 4
-	dataBlobLen := len(data) - int(dataBlobOffset)
-
-	b.rleStream = make([]byte, rleBlobLen)
-	b.dataStream = make([]byte, dataBlobLen)
-	n, err := reader.Read(b.rleStream)
-	if err != nil || n != int(rleBlobLen) {
-		return fmt.Errorf("%w: end of data reached while reading RLE blob", ErrBlobDataInconsistent)
+	b.heightCrumbs = data[0]
+	b.widthTiles = data[1]
+	b.restartInterval = 0
+	b.restartPoints = []pixCrumbRLERestartPoint{{}}
+	headerSize := 4
+	dataBlobOffset := int(binary.LittleEndian.Uint16(data[2:4]))
+	if dataBlobOffset == 0 {
+		if err := checkBlobSize(data, 7); err != nil {
+			return err
+		}
+		dataBlobOffset = int(binary.LittleEndian.Uint16(data[4:6]))
+		b.restartInterval = data[6]
+		if b.restartInterval == 0 {
+			return fmt.Errorf("%w: restart interval is zero", ErrBlobDataInvalid)
+		}
+		numSegments := getNumSegments(b.heightCrumbs, b.restartInterval)
+		headerSize = 7 + 8*(numSegments-1)
+		if err := checkBlobSize(data, headerSize); err != nil {
+			return err
+		}
+		for i := 1; i < numSegments; i++ {
+			entry := data[7+8*(i-1):]
+			b.restartPoints = append(b.restartPoints, pixCrumbRLERestartPoint{
+				rleBitOffset:  binary.LittleEndian.Uint32(entry[0:4]),
+				dataBitOffset: binary.LittleEndian.Uint32(entry[4:8]),
+			})
+		}
 	}
-	n, err = reader.Read(b.dataStream)
-	if err != nil || n != int(dataBlobLen) {
-		return fmt.Errorf("%w: end of data reached while reading data blob", ErrBlobDataInconsistent)
+	if dataBlobOffset < headerSize || dataBlobOffset > len(data) {
+		return fmt.Errorf("%w: data stream offset %d is outside of the blob (%d to %d)", ErrBlobDataInconsistent, dataBlobOffset, headerSize, len(data))
+	}
+	b.rleStream = append([]byte(nil), data[headerSize:dataBlobOffset]...)
+	b.dataStream = append([]byte(nil), data[dataBlobOffset:]...)
+
+	for i, rp := range b.restartPoints[1:] {
+		prev := b.restartPoints[i]
+		if rp.rleBitOffset < prev.rleBitOffset || rp.dataBitOffset < prev.dataBitOffset {
+			return fmt.Errorf("%w: restart point %d comes before the one preceding it", ErrBlobDataInconsistent, i+1)
+		}
+		if uint64(rp.rleBitOffset) > uint64(len(b.rleStream))*8 || uint64(rp.dataBitOffset) > uint64(len(b.dataStream))*8 {
+			return fmt.Errorf("%w: restart point %d is past the end of the blob", ErrBlobDataInconsistent, i+1)
+		}
 	}
 	return nil
 }
@@ -79,9 +150,18 @@ func (b *pixCrumbRLEBlob) Unmarshal(data []byte) error {
 type pixCrumbRLEState struct {
 	blob    pixCrumbRLEBlob
 	rleMode bool
+	trace   []DecodeCheckpoint
+	// crumb rows between restart points inserted by Compress, 0 for none
+	restartInterval int
+	// codes literals with the order-1 Huffman tables instead of plain 4-bit crumbs
+	order1Literals bool
 }
 
 var _ PixCrumbCodec = &pixCrumbRLEState{}
+var _ PixCrumbTracingDecoder = &pixCrumbRLEState{}
+var _ PixCrumbRestartEncoder = &pixCrumbRLEState{}
+var _ PixCrumbRestartDecoder = &pixCrumbRLEState{}
+var _ PixCrumbStreamingDecoder = &pixCrumbRLEState{}
 
 func NewPixCrumbRLEEncoder() PixCrumbEncoder {
 	return &pixCrumbRLEState{}
@@ -99,14 +179,44 @@ func NewPixCrumbRLE() PixCrumbCodec {
 	return &pixCrumbRLEState{}
 }
 
+func NewPixCrumbRLEOrder1() PixCrumbCodec {
+	return &pixCrumbRLEState{order1Literals: true}
+}
+
 func (s *pixCrumbRLEState) GetName() string {
+	if s.order1Literals {
+		return pcRLEOrder1Name
+	}
 	return pcRLEName
 }
 
 func (s *pixCrumbRLEState) GetAbbrevName() string {
+	if s.order1Literals {
+		return pcRLEOrder1AbbrevName
+	}
 	return pcRLEAbbrevName
 }
 
+func (s *pixCrumbRLEState) newLiteralCoder(
+	encSrc codingmethods.CrumbReader,
+	encDest codingmethods.BitstreamMSBWriter,
+	decSrc codingmethods.BitstreamMSBReader,
+	decDest codingmethods.CrumbWriter,
+) (codingmethods.CodingMethod, error) {
+	if s.order1Literals {
+		return codingmethods.NewOrder1HuffmanCrumbLiteralCoder(encSrc, encDest, decSrc, decDest, nil)
+	}
+	return codingmethods.NewZeroTerminated4BitCrumbLiteralCoder(encSrc, encDest, decSrc, decDest)
+}
+
+func (s *pixCrumbRLEState) NewBlob() PixCrumbBlob {
+	return &pixCrumbRLEBlob{}
+}
+
+func (s *pixCrumbRLEState) GetDecodeTrace() []DecodeCheckpoint {
+	return s.trace
+}
+
 func (s *pixCrumbRLEState) LoadBlob(pcBlob PixCrumbBlob) error {
 	if b, ok := pcBlob.(*pixCrumbRLEBlob); !ok {
 		return fmt.Errorf("cannot load blob into PixCrumbRLE: %w", ErrWrongBlogTypeForCodec)
@@ -116,6 +226,22 @@ func (s *pixCrumbRLEState) LoadBlob(pcBlob PixCrumbBlob) error {
 	return nil
 }
 
+func (s *pixCrumbRLEState) SetRestartInterval(crumbRows int) error {
+	if crumbRows < 0 || crumbRows > 255 {
+		return fmt.Errorf("restart interval of %d crumb rows is out of range (0-255)", crumbRows)
+	}
+	s.restartInterval = crumbRows
+	return nil
+}
+
+func (s *pixCrumbRLEState) GetRestartInterval() int {
+	return int(s.blob.restartInterval)
+}
+
+func (s *pixCrumbRLEState) GetNumRestartPoints() int {
+	return len(s.blob.getRestartPoints())
+}
+
 func (s *pixCrumbRLEState) Compress(crp *imgtools.CrumbPlane) (blob PixCrumbBlob, err error) {
 	wb := crp.GetWidthBpBytes()
 	h := crp.GetHeightCrumbs()
@@ -123,89 +249,255 @@ func (s *pixCrumbRLEState) Compress(crp *imgtools.CrumbPlane) (blob PixCrumbBlob
 		return nil, fmt.Errorf("%w: rounded pixel dimensions %dx%d exceed max dimensions of 2040x510", ErrImageTooLarge, wb*8, h*2)
 	}
 	s.blob = pixCrumbRLEBlob{
-		heightCrumbs: uint8(h),
-		widthTiles:   uint8(wb),
-		rleStream:    make([]byte, 0),
-		dataStream:   make([]byte, 0),
+		heightCrumbs:    uint8(h),
+		widthTiles:      uint8(wb),
+		restartInterval: uint8(s.restartInterval),
+		rleStream:       make([]byte, 0),
+		dataStream:      make([]byte, 0),
 	}
 	rleEnc := codingmethods.NewBitstreamMSBWriter(&s.blob.rleStream)
 	dataEnc := codingmethods.NewBitstreamMSBWriter(&s.blob.dataStream)
-	s.rleMode = false
 
 	rawData := crp.GetCrumbs()
-	crumbReader, err := codingmethods.NewCrumbReader(&rawData)
+	segmentRows := len(rawData)
+	if s.restartInterval != 0 {
+		segmentRows = s.restartInterval
+	}
+	// Each segment is coded as a plane of its own, so that decoding it needs nothing from the segments before it.
+	for firstRow := 0; firstRow < len(rawData); firstRow += segmentRows {
+		s.blob.restartPoints = append(s.blob.restartPoints, pixCrumbRLERestartPoint{
+			rleBitOffset:  uint32(rleEnc.Tell()),
+			dataBitOffset: uint32(dataEnc.Tell()),
+		})
+		segment := rawData[firstRow:min(firstRow+segmentRows, len(rawData))]
+		if err := s.compressSegment(segment, rleEnc, dataEnc); err != nil {
+			return nil, err
+		}
+	}
+
+	// The encoder may be reused for other planes, so the caller gets its own copy of the blob.
+	result := s.blob
+	return &result, nil
+}
+
+func (s *pixCrumbRLEState) compressSegment(segment [][]imgtools.Crumb, rleEnc, dataEnc codingmethods.BitstreamMSBWriter) error {
+	s.rleMode = false
+	crumbReader, err := codingmethods.NewCrumbReader(&segment)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	literalEncoder, err := codingmethods.NewZeroTerminated4BitCrumbLiteralCoder(crumbReader, dataEnc, nil, nil)
+	literalEncoder, err := s.newLiteralCoder(crumbReader, dataEnc, nil, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	rleEncoder, err := codingmethods.NewExpGolombCodedZeroRLECoder(crumbReader, rleEnc, nil, nil, 2)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	for !crumbReader.IsAtEnd() {
 		if !s.rleMode {
 			_, _, err := literalEncoder.EncodeSome()
 			if err != nil {
-				return nil, err
+				return err
 			}
 			s.rleMode = true
 		} else {
 			_, _, err := rleEncoder.EncodeSome()
 			if err != nil {
-				return nil, err
+				return err
 			}
 			s.rleMode = false
 		}
 	}
 
 	//fmt.Printf("encoding completed with %d modeswitches, %d literal crumbs written, %d rle crumbs processed, total %d crumbs\n", s.modeSwitches, s.literalCrumbsWritten, s.rleCrumbsProcessed, s.literalCrumbsWritten+s.rleCrumbsProcessed)
-
-	return &s.blob, nil
+	return nil
 }
 
 func (s *pixCrumbRLEState) Decompress() (*imgtools.CrumbPlane, error) {
+	return s.DecompressFromRestart(0)
+}
+
+func (s *pixCrumbRLEState) DecompressFromRestart(restart int) (*imgtools.CrumbPlane, error) {
+	restartPoints := s.blob.getRestartPoints()
+	if restart < 0 || restart >= len(restartPoints) {
+		return nil, fmt.Errorf("%w: %d (blob has %d)", ErrNoSuchRestartPoint, restart, len(restartPoints))
+	}
+	widthCrumbs := uint64(s.blob.widthTiles) * 4
+	if widthCrumbs*uint64(s.blob.heightCrumbs) == 0 {
+		return nil, fmt.Errorf("%w: blob has zero size", ErrBlobDataInvalid)
+	}
+	segmentRows := int(s.blob.heightCrumbs)
+	if s.blob.restartInterval != 0 {
+		segmentRows = int(s.blob.restartInterval)
+	}
+
 	rleDec := codingmethods.NewBitstreamMSBReader(&s.blob.rleStream)
 	dataDec := codingmethods.NewBitstreamMSBReader(&s.blob.dataStream)
-	s.rleMode = false
+	s.trace = s.trace[:0]
+	var crumbMtx [][]imgtools.Crumb
+	for i := restart; i < len(restartPoints); i++ {
+		// The literal decoder may have read ahead into the next segment, so every segment starts with a seek.
+		if _, err := rleDec.Seek(int64(restartPoints[i].rleBitOffset), io.SeekStart); err != nil {
+			return nil, newDecodeError("rle", int64(restartPoints[i].rleBitOffset), err)
+		}
+		if _, err := dataDec.Seek(int64(restartPoints[i].dataBitOffset), io.SeekStart); err != nil {
+			return nil, newDecodeError("data", int64(restartPoints[i].dataBitOffset), err)
+		}
+		numRows := min(segmentRows, int(s.blob.heightCrumbs)-i*segmentRows)
+		segment, err := s.decompressSegment(rleDec, dataDec, widthCrumbs, numRows, int64(len(crumbMtx))*int64(widthCrumbs))
+		if err != nil {
+			return nil, err
+		}
+		crumbMtx = append(crumbMtx, segment...)
+	}
 
-	crumbWriter := codingmethods.NewCrumbWriter(uint64(s.blob.widthTiles) * 4)
+	return imgtools.MakeCrumbPlane(&crumbMtx), nil
+}
+
+// pixCrumbRLESegmentDecoder decodes one segment of a plane, one literal or zero run at a time.
+type pixCrumbRLESegmentDecoder struct {
+	rleDec, dataDec codingmethods.BitstreamMSBReader
+	crumbWriter     codingmethods.CrumbWriter
+	literalDecoder  codingmethods.CodingMethod
+	rleDecoder      codingmethods.CodingMethod
+	rleMode         bool
+	totalCrumbs     int64
+}
 
-	literalDecoder, err := codingmethods.NewZeroTerminated4BitCrumbLiteralCoder(nil, nil, dataDec, crumbWriter)
+func (s *pixCrumbRLEState) newSegmentDecoder(rleDec, dataDec codingmethods.BitstreamMSBReader, widthCrumbs uint64, numRows int) (*pixCrumbRLESegmentDecoder, error) {
+	crumbWriter := codingmethods.NewCrumbWriter(widthCrumbs)
+	literalDecoder, err := s.newLiteralCoder(nil, nil, dataDec, crumbWriter)
 	if err != nil {
 		return nil, err
 	}
-
 	rleDecoder, err := codingmethods.NewExpGolombCodedZeroRLECoder(nil, nil, rleDec, crumbWriter, 2)
 	if err != nil {
 		return nil, err
 	}
+	return &pixCrumbRLESegmentDecoder{
+		rleDec:         rleDec,
+		dataDec:        dataDec,
+		crumbWriter:    crumbWriter,
+		literalDecoder: literalDecoder,
+		rleDecoder:     rleDecoder,
+		totalCrumbs:    int64(widthCrumbs) * int64(numRows),
+	}, nil
+}
 
-	for crumbWriter.GetHeightCrumbs() < int(s.blob.heightCrumbs) && !crumbWriter.IsLengthAligned() {
-		if !s.rleMode {
-			_, _, err := literalDecoder.DecodeSome()
-			if err != nil {
-				return nil, err
-			}
-			s.rleMode = true
-		} else {
-			_, _, err := rleDecoder.DecodeSome()
-			if err != nil {
-				return nil, err
-			}
-			s.rleMode = false
+func (d *pixCrumbRLESegmentDecoder) isDone() bool {
+	return d.crumbWriter.Tell() >= d.totalCrumbs
+}
+
+// DecodeSome decodes one literal or zero run, alternating between the two like the encoder does.
+func (d *pixCrumbRLESegmentDecoder) DecodeSome() (nCrumbs uint64, bitsRead uint64, err error) {
+	if !d.rleMode {
+		d.rleMode = true
+		return d.literalDecoder.DecodeSome()
+	}
+	d.rleMode = false
+	if d.rleDec.BitsLeft() <= 0 {
+		return 0, 0, fmt.Errorf("%w: stream ended after %d of %d crumbs", ErrBlobDataInconsistent, d.crumbWriter.Tell(), d.totalCrumbs)
+	}
+	return d.rleDecoder.DecodeSome()
+}
+
+// getStream returns the name and position of the stream the next DecodeSome call reads from.
+func (d *pixCrumbRLESegmentDecoder) getStream() (name string, bitOffset int64) {
+	if d.rleMode {
+		return "rle", d.rleDec.Tell()
+	}
+	return "data", d.dataDec.Tell()
+}
+
+// decompressSegment decodes numRows crumb rows from the current positions of the streams. Checkpoints are recorded
+// with crumbOffset added, so that they count crumbs from wherever decoding started.
+func (s *pixCrumbRLEState) decompressSegment(
+	rleDec, dataDec codingmethods.BitstreamMSBReader,
+	widthCrumbs uint64,
+	numRows int,
+	crumbOffset int64,
+) ([][]imgtools.Crumb, error) {
+	segDecoder, err := s.newSegmentDecoder(rleDec, dataDec, widthCrumbs, numRows)
+	if err != nil {
+		return nil, err
+	}
+
+	for !segDecoder.isDone() {
+		var checkpoint DecodeCheckpoint
+		checkpoint.Stream, checkpoint.BitOffset = segDecoder.getStream()
+		if _, _, err := segDecoder.DecodeSome(); err != nil {
+			return nil, newDecodeError(checkpoint.Stream, checkpoint.BitOffset, err)
 		}
+		checkpoint.Crumbs = crumbOffset + segDecoder.crumbWriter.Tell()
+		s.trace = append(s.trace, checkpoint)
 	}
 
-	crumbMtx, err := crumbWriter.GetCrumbMatrix()
+	// The literal decoder may have read past the end of the segment from the padding of the data stream, or from the
+	// start of the next segment.
+	if err := segDecoder.crumbWriter.Truncate(uint64(segDecoder.totalCrumbs)); err != nil {
+		return nil, err
+	}
+	crumbMtx, err := segDecoder.crumbWriter.GetCrumbMatrix()
 	if err != nil {
 		return nil, err
 	}
+	return *crumbMtx, nil
+}
+
+func (s *pixCrumbRLEState) NewIncrementalDecoder() (*IncrementalDecoder, error) {
+	return s.NewIncrementalDecoderFromRestart(0)
+}
+
+// NewIncrementalDecoderFromRestart returns an IncrementalDecoder that starts at the given restart point.
+func (s *pixCrumbRLEState) NewIncrementalDecoderFromRestart(restart int) (*IncrementalDecoder, error) {
+	restartPoints := s.blob.getRestartPoints()
+	if restart < 0 || restart >= len(restartPoints) {
+		return nil, fmt.Errorf("%w: %d (blob has %d)", ErrNoSuchRestartPoint, restart, len(restartPoints))
+	}
+	widthCrumbs := uint64(s.blob.widthTiles) * 4
+	if widthCrumbs*uint64(s.blob.heightCrumbs) == 0 {
+		return nil, fmt.Errorf("%w: blob has zero size", ErrBlobDataInvalid)
+	}
+	heightRows := int(s.blob.heightCrumbs)
+	segmentRows := heightRows
+	if s.blob.restartInterval != 0 {
+		segmentRows = int(s.blob.restartInterval)
+	}
 
-	return imgtools.MakeCrumbPlane(crumbMtx), nil
+	// The decoder keeps its own copy of the streams, so that loading another blob doesn't pull them from under it.
+	blob := s.blob
+	rleDec := codingmethods.NewBitstreamMSBReader(&blob.rleStream)
+	dataDec := codingmethods.NewBitstreamMSBReader(&blob.dataStream)
+	segment := restart - 1
+	var segDecoder *pixCrumbRLESegmentDecoder
+	var segSource func() ([]imgtools.Crumb, error)
+	decodeSome := func() ([]imgtools.Crumb, error) {
+		if segDecoder == nil || segDecoder.isDone() {
+			segment++
+			rp := restartPoints[segment]
+			if _, err := rleDec.Seek(int64(rp.rleBitOffset), io.SeekStart); err != nil {
+				return nil, newDecodeError("rle", int64(rp.rleBitOffset), err)
+			}
+			if _, err := dataDec.Seek(int64(rp.dataBitOffset), io.SeekStart); err != nil {
+				return nil, newDecodeError("data", int64(rp.dataBitOffset), err)
+			}
+			var err error
+			segDecoder, err = s.newSegmentDecoder(rleDec, dataDec, widthCrumbs, min(segmentRows, heightRows-segment*segmentRows))
+			if err != nil {
+				return nil, err
+			}
+			segSource = newCrumbWriterSource(segDecoder.DecodeSome, segDecoder.crumbWriter, segDecoder.totalCrumbs)
+		}
+		stream, bitOffset := segDecoder.getStream()
+		crumbs, err := segSource()
+		if err != nil {
+			return nil, newDecodeError(stream, bitOffset, err)
+		}
+		return crumbs, nil
+	}
+	return newIncrementalDecoder(widthCrumbs, heightRows, restart*segmentRows, int(s.blob.restartInterval), decodeSome), nil
 }
@@ -0,0 +1,140 @@
+package comp
+
+import (
+	"fmt"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp/codingmethods"
+)
+
+// The tilemap codec works on 16-bit tilemap words (tile index in bits 0-13, flip bits in 14 and 15). It codes them as
+// a bitstream of commands, each followed by n, an order-0 Exp-Golomb coded number:
+//
+//   - 0: literal run: n + 1 words follow, each as 2 flip bits then the tile index as an order-3 Exp-Golomb number
+//   - 10: repeat run: repeat the previous word n + 1 times
+//   - 11: incrementing run: n + 1 words, each with the tile index of the previous word plus one and the same flips
+//
+// Before the first word, the previous word is 0.
+
+const (
+	tilemapTileMask        = 0x3FFF
+	tilemapTileGolombOrder = 3
+	tilemapMaxRun          = 0xFFFF
+)
+
+// MaxTilemapWords is the largest tilemap accepted by DecompressTilemap and containers. It matches MaxBlobSize, and
+// covers images of up to 8192x8192 pixels.
+const MaxTilemapWords = MaxBlobSize
+
+func nextIncrementedWord(w uint16) uint16 {
+	return w&^tilemapTileMask | (w+1)&tilemapTileMask
+}
+
+// countTilemapRun returns how many words starting at words[i] continue a run from prev, where next gives the word
+// expected after a given one.
+func countTilemapRun(words []uint16, i int, prev uint16, next func(uint16) uint16) int {
+	n := 0
+	for i+n < len(words) && n < tilemapMaxRun {
+		prev = next(prev)
+		if words[i+n] != prev {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+func repeatedWord(w uint16) uint16 {
+	return w
+}
+
+// CompressTilemap codes tilemap words with the tilemap codec. Runs are picked greedily, preferring the longer of a
+// repeat and an incrementing run, and words that start neither are gathered into literal runs.
+func CompressTilemap(words []uint16) []byte {
+	var data []byte
+	enc := codingmethods.NewBitstreamMSBWriter(&data)
+	prev := uint16(0)
+	for i := 0; i < len(words); {
+		repeatLen := countTilemapRun(words, i, prev, repeatedWord)
+		incLen := countTilemapRun(words, i, prev, nextIncrementedWord)
+		switch {
+		case repeatLen > 0 && repeatLen >= incLen:
+			enc.WriteBits(0b10, 2)
+			enc.WriteOrderKExpGolombNumber16(uint16(repeatLen-1), 0)
+			i += repeatLen
+		case incLen > 0:
+			enc.WriteBits(0b11, 2)
+			enc.WriteOrderKExpGolombNumber16(uint16(incLen-1), 0)
+			i += incLen
+			prev = words[i-1]
+		default:
+			n := 1
+			for i+n < len(words) && n < tilemapMaxRun {
+				if words[i+n] == words[i+n-1] || words[i+n] == nextIncrementedWord(words[i+n-1]) {
+					break
+				}
+				n++
+			}
+			enc.WriteBit(0)
+			enc.WriteOrderKExpGolombNumber16(uint16(n-1), 0)
+			for _, w := range words[i : i+n] {
+				enc.WriteBits(uint64(w>>14), 2)
+				enc.WriteOrderKExpGolombNumber16(w&tilemapTileMask, tilemapTileGolombOrder)
+			}
+			i += n
+			prev = words[i-1]
+		}
+	}
+	return data
+}
+
+// DecompressTilemap decodes numWords tilemap words coded by CompressTilemap.
+func DecompressTilemap(data []byte, numWords int) ([]uint16, error) {
+	if numWords < 0 || numWords > MaxTilemapWords {
+		return nil, fmt.Errorf("%w: tilemap of %d words (max %d)", ErrBlobTooLarge, numWords, MaxTilemapWords)
+	}
+	dec := codingmethods.NewBitstreamMSBReader(&data)
+	words := make([]uint16, 0, numWords)
+	prev := uint16(0)
+	for len(words) < numWords {
+		offset := dec.Tell()
+		command, err := dec.ReadBit()
+		if err == nil && command == 1 {
+			var kind uint8
+			kind, err = dec.ReadBit()
+			command = 0b10 | kind
+		}
+		if err != nil {
+			return nil, newDecodeError("tilemap", offset, err)
+		}
+		n, err := dec.ReadOrderKExpGolombNumber16(0)
+		if err != nil {
+			return nil, newDecodeError("tilemap", offset, err)
+		}
+		runLen := int(n) + 1
+		if len(words)+runLen > numWords {
+			return nil, newDecodeError("tilemap", offset, fmt.Errorf("%w: run of %d words goes past the end of the %d-word tilemap", ErrBlobDataInconsistent, runLen, numWords))
+		}
+
+		for range runLen {
+			switch command {
+			case 0b0:
+				flips, err := dec.ReadBits(2)
+				if err != nil {
+					return nil, newDecodeError("tilemap", dec.Tell(), err)
+				}
+				tile, err := dec.ReadOrderKExpGolombNumber16(tilemapTileGolombOrder)
+				if err != nil {
+					return nil, newDecodeError("tilemap", dec.Tell(), err)
+				}
+				if tile > tilemapTileMask {
+					return nil, newDecodeError("tilemap", dec.Tell(), fmt.Errorf("%w: tile index %d is out of range", ErrBlobDataInvalid, tile))
+				}
+				prev = uint16(flips)<<14 | tile
+			case 0b11:
+				prev = nextIncrementedWord(prev)
+			}
+			words = append(words, prev)
+		}
+	}
+	return words, nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+// Golden test vectors: tiny synthetic images, stored as paletted PNGs, next to the Marshal() output of every bitplane
+// for every codec, in files named <image>.<codec>.bp<plane>.bin.
+
+const vectorDir = "testdata/vectors"
+
+type syntheticImage struct {
+	name          string
+	width, height int
+	numColors     int
+	colorIndexAt  func(x, y int) uint8
+}
+
+var syntheticImages = []syntheticImage{
+	{"zero-8x2", 8, 2, 2, func(x, y int) uint8 { return 0 }},
+	{"zero-1x1", 1, 1, 2, func(x, y int) uint8 { return 0 }},
+	{"checker-16x16", 16, 16, 2, func(x, y int) uint8 { return uint8((x + y) % 2) }},
+	{"checker2x2-17x13", 17, 13, 4, func(x, y int) uint8 { return uint8((x/2+y/2)%2 + 2*((x/2)%2)) }},
+	{"odd-9x3", 9, 3, 4, func(x, y int) uint8 { return uint8((x*y + x) % 4) }},
+	// planes 1 and 3 are all ones, planes 0 and 2 all zeros
+	{"planeconst-32x8", 32, 8, 16, func(x, y int) uint8 { return 0b1010 }},
+	{"ramp-64x16", 64, 16, 16, func(x, y int) uint8 { return uint8(x / 4) }},
+	{"noise-40x24", 40, 24, 16, func(x, y int) uint8 {
+		h := uint32(x*73856093) ^ uint32(y*19349663)
+		h ^= h >> 13
+		h *= 0x5bd1e995
+		return uint8(h>>28) & 0xF
+	}},
+	{"max-2040x510", 2040, 510, 2, func(x, y int) uint8 {
+		if (x/8+y/2)%5 == 0 || x == y {
+			return 1
+		}
+		return 0
+	}},
+}
+
+func (si *syntheticImage) render() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, si.width, si.height), imgtools.GrayscalePalette(si.numColors))
+	for y := range si.height {
+		for x := range si.width {
+			img.SetColorIndex(x, y, si.colorIndexAt(x, y))
+		}
+	}
+	return img
+}
+
+func vectorFileName(dir, imageName, codecName string, plane int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s.%s.bp%d.bin", imageName, codecName, plane))
+}
+
+// writeVectorImages renders the synthetic images into dir as PNGs.
+func writeVectorImages(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, si := range syntheticImages {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, si.render()); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, si.name+".png"), buf.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkVector compresses one image with one codec and compares the results with the expected blobs, then decodes
+// the expected blobs and compares them with the image. With update set, the expected blobs are rewritten instead.
+func checkVector(dir, imageFile, codecName string, update bool) (failures []string, err error) {
+	imageName := strings.TrimSuffix(filepath.Base(imageFile), filepath.Ext(imageFile))
+	img, err := imgtools.LoadImage(imageFile)
+	if err != nil {
+		return nil, err
+	}
+	planarImg, err := imgtools.NewPlanarImage(img)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := comp.NewPixCrumbCodecByName(codecName)
+	if err != nil {
+		return nil, err
+	}
+	originalPlanes := planarImg.Clone().GetBitplanes()
+	blobs, _, err := compressPlanarImage(planarImg, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	fail := func(plane int, format string, args ...any) {
+		failures = append(failures, fmt.Sprintf("%s, %s, BP%d: %s", imageName, codecName, plane, fmt.Sprintf(format, args...)))
+	}
+	for i, blob := range blobs {
+		data, err := blob.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		vectorFile := vectorFileName(dir, imageName, codecName, i)
+		if update {
+			if err := os.WriteFile(vectorFile, data, 0644); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		expected, err := os.ReadFile(vectorFile)
+		if errors.Is(err, os.ErrNotExist) {
+			fail(i, "missing vector %s", vectorFile)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(data, expected) {
+			diffIdx := 0
+			for diffIdx < min(len(data), len(expected)) && data[diffIdx] == expected[diffIdx] {
+				diffIdx++
+			}
+			fail(i, "encoder output differs from vector at byte %d (%d bytes, expected %d)", diffIdx, len(data), len(expected))
+		}
+
+		decodedCrumbs, _, err := decodePlaneData(codecName, expected)
+		if err != nil {
+			fail(i, "vector could not be decoded: %s", err.Error())
+			continue
+		}
+		decodedBp := imgtools.CrumbPlaneToBitplane(decodedCrumbs)
+		decodedBp.DeltaDecode()
+		if x, y, found := firstBitplaneMismatch(&originalPlanes[i], decodedBp); found {
+			fail(i, "decoded vector differs from image at pixel (%d, %d)", x, y)
+		}
+	}
+	return failures, nil
+}
+
+// firstBitplaneMismatch compares a decoded bitplane, which may be padded on the right and bottom, with the original.
+func firstBitplaneMismatch(original, decoded *imgtools.Bitplane) (x, y uint64, found bool) {
+	if decoded.GetWidthPx() < original.GetWidthPx() || decoded.GetHeightPx() < original.GetHeightPx() {
+		return 0, 0, true
+	}
+	for y := range original.GetHeightPx() {
+		for x := range original.GetWidthPx() {
+			if original.GetPixel(x, y) != decoded.GetPixel(x, y) {
+				return x, y, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func runConformance(args []string) {
+	flags := flag.NewFlagSet("conformance", flag.ExitOnError)
+	codecList := flags.String("codecs", strings.Join(comp.GetPixCrumbCodecNames(), ","), "comma-separated list of codecs to check")
+	update := flags.Bool("update", false, "regenerate the synthetic images and expected blobs instead of checking them")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s conformance [flags] [vector directory (default %s)]\n", os.Args[0], vectorDir)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	dir := vectorDir
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	} else if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		log.Fatalf("error: there is no '%s' directory here, run from the cmd directory or give the vector directory", dir)
+	}
+	if *update {
+		handle(writeVectorImages(dir))
+	}
+
+	imageFiles, err := filepath.Glob(filepath.Join(dir, "*.png"))
+	handle(err)
+	if len(imageFiles) == 0 {
+		log.Fatalf("error: no test vector images found in '%s'", dir)
+	}
+	slices.Sort(imageFiles)
+
+	var failures []string
+	numChecked := 0
+	for _, codecName := range strings.Split(*codecList, ",") {
+		for _, imageFile := range imageFiles {
+			vectorFailures, err := checkVector(dir, imageFile, codecName, *update)
+			if err != nil {
+				vectorFailures = []string{fmt.Sprintf("%s, %s: %s", imageFile, codecName, err.Error())}
+			}
+			failures = append(failures, vectorFailures...)
+			numChecked++
+		}
+	}
+
+	if *update {
+		fmt.Printf("Wrote test vectors for %d images and codecs to %s\n", numChecked, dir)
+		return
+	}
+	for _, f := range failures {
+		fmt.Println("FAIL:", f)
+	}
+	fmt.Printf("%d images and codecs checked, %d failures\n", numChecked, len(failures))
+	if len(failures) > 0 {
+		os.Exit(1)
+	}
+}
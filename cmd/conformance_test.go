@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp"
+)
+
+// TestConformance checks every codec against the golden test vectors. After an intentional format change, regenerate
+// them with the conformance subcommand's -update flag.
+func TestConformance(t *testing.T) {
+	imageFiles, err := filepath.Glob(filepath.Join(vectorDir, "*.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imageFiles) == 0 {
+		t.Fatalf("no test vector images found in '%s'", vectorDir)
+	}
+	slices.Sort(imageFiles)
+
+	for _, codecName := range comp.GetPixCrumbCodecNames() {
+		for _, imageFile := range imageFiles {
+			imageName := strings.TrimSuffix(filepath.Base(imageFile), filepath.Ext(imageFile))
+			t.Run(codecName+"/"+imageName, func(t *testing.T) {
+				failures, err := checkVector(vectorDir, imageFile, codecName, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, f := range failures {
+					t.Error(f)
+				}
+			})
+		}
+	}
+}
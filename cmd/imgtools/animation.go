@@ -0,0 +1,149 @@
+package imgtools
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"slices"
+)
+
+// AnimationFrame is one full frame of an animation.
+type AnimationFrame struct {
+	Image *PlanarImage
+	// display time in 1/100 s, 0 if unknown
+	DelayCs int
+}
+
+// LoadAnimatedGIF returns the frames of an animated GIF as full images, with the sub-rectangle updates, transparency
+// and disposal methods of the file applied. All frames share the global palette; frames with a local palette of their
+// own are remapped onto it by nearest color. If the first frame has a transparent color, it keeps alpha 0 in the
+// shared palette, as with single images, and the canvas starts out and is cleared to it instead of the background
+// color. Each frame then goes through opts the way LoadImageWithOptions applies them to single images.
+func LoadAnimatedGIF(filename string, opts PaletteOptions) ([]AnimationFrame, error) {
+	reader, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	g, err := gif.DecodeAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Image) == 0 {
+		return nil, fmt.Errorf("GIF file '%s' has no frames", filename)
+	}
+
+	palette, ok := g.Config.ColorModel.(color.Palette)
+	if !ok || len(palette) == 0 {
+		palette = g.Image[0].Palette
+	}
+	palette = slices.Clone(palette)
+	background := uint8(0)
+	if int(g.BackgroundIndex) < len(palette) {
+		background = g.BackgroundIndex
+	}
+	// The decoder only marks the transparent index in the palette of each frame, not in the global one.
+	if idx := TransparentIndex(g.Image[0].Palette); idx >= 0 && idx < len(palette) {
+		palette[idx] = g.Image[0].Palette[idx]
+		background = uint8(idx)
+	}
+	canvas := image.NewPaletted(image.Rect(0, 0, g.Config.Width, g.Config.Height), palette)
+	fillPaletted(canvas, canvas.Rect, background)
+
+	var frames []AnimationFrame
+	for i, frame := range g.Image {
+		var saved *image.Paletted
+		if g.Disposal != nil && g.Disposal[i] == gif.DisposalPrevious {
+			saved = clonePaletted(canvas)
+		}
+
+		// Maps indices of the frame's palette to the canvas palette; transparent entries map to -1.
+		indexMap := make([]int, len(frame.Palette))
+		for idx, c := range frame.Palette {
+			if _, _, _, a := c.RGBA(); a == 0 {
+				indexMap[idx] = -1
+			} else if idx < len(palette) && palette[idx] == c {
+				indexMap[idx] = idx
+			} else {
+				indexMap[idx] = palette.Index(c)
+			}
+		}
+		bounds := frame.Bounds().Intersect(canvas.Rect)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if idx := indexMap[frame.ColorIndexAt(x, y)]; idx >= 0 {
+					canvas.SetColorIndex(x, y, uint8(idx))
+				}
+			}
+		}
+
+		var frameImg image.PalettedImage = clonePaletted(canvas)
+		if opts.ReferencePalette != nil {
+			frameImg, err = convertToPaletted(canvas, opts)
+			if err != nil {
+				return nil, fmt.Errorf("could not build a palette for GIF file '%s', frame %d: %w", filename, i, err)
+			}
+		}
+		padded, err := PadImagePalette(frameImg, opts)
+		if err != nil {
+			return nil, fmt.Errorf("GIF file '%s', frame %d: %w", filename, i, err)
+		}
+		planarImg, err := NewPlanarImage(padded)
+		if err != nil {
+			return nil, fmt.Errorf("GIF file '%s', frame %d: %w", filename, i, err)
+		}
+		frames = append(frames, AnimationFrame{Image: planarImg, DelayCs: g.Delay[i]})
+
+		if g.Disposal != nil {
+			switch g.Disposal[i] {
+			case gif.DisposalBackground:
+				fillPaletted(canvas, bounds, background)
+			case gif.DisposalPrevious:
+				canvas = saved
+			}
+		}
+	}
+	return frames, nil
+}
+
+// LoadAnimationFrames loads every file as one frame of an animation. The frames must have the same size and palette.
+func LoadAnimationFrames(filenames []string, opts PaletteOptions) ([]AnimationFrame, error) {
+	var frames []AnimationFrame
+	for i, filename := range filenames {
+		img, err := LoadImageWithOptions(filename, opts)
+		if err != nil {
+			return nil, err
+		}
+		planarImg, err := NewPlanarImage(img)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			first := frames[0].Image
+			if planarImg.GetWidthPx() != first.GetWidthPx() || planarImg.GetHeightPx() != first.GetHeightPx() {
+				return nil, fmt.Errorf("frame '%s' is %dx%d, but the first frame is %dx%d", filename, planarImg.GetWidthPx(), planarImg.GetHeightPx(), first.GetWidthPx(), first.GetHeightPx())
+			}
+			if !slices.Equal(planarImg.GetPalette(), first.GetPalette()) {
+				return nil, fmt.Errorf("frame '%s' does not have the same palette as the first frame", filename)
+			}
+		}
+		frames = append(frames, AnimationFrame{Image: planarImg})
+	}
+	return frames, nil
+}
+
+func fillPaletted(im *image.Paletted, rect image.Rectangle, idx uint8) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			im.SetColorIndex(x, y, idx)
+		}
+	}
+}
+
+func clonePaletted(im *image.Paletted) *image.Paletted {
+	result := *im
+	result.Pix = slices.Clone(im.Pix)
+	return &result
+}
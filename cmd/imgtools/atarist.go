@@ -0,0 +1,92 @@
+package imgtools
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+)
+
+// Atari ST screen dumps: Degas/Degas Elite (.PI1/.PI2/.PI3) and NEOchrome (.NEO). Both store an uncompressed
+// 32000-byte word-interleaved screen.
+
+const (
+	stScreenSize   = 32000
+	degasHeaderLen = 34
+	neoHeaderLen   = 128
+)
+
+var ErrAtariSTInvalid = errors.New("invalid Atari ST image data")
+
+type stResolution struct {
+	width, height uint64
+	numPlanes     int
+}
+
+var stResolutions = []stResolution{
+	{320, 200, 4},
+	{640, 200, 2},
+	{640, 400, 1},
+}
+
+// stPaletteToColors converts ST/STE palette words (0x0RGB, with the STE's extra bit as the top bit of each nibble).
+func stPaletteToColors(words []byte, numColors int) color.Palette {
+	result := make(color.Palette, numColors)
+	for i := range result {
+		w := binary.BigEndian.Uint16(words[i*2:])
+		var rgb [3]uint8
+		for ch := range rgb {
+			n := uint8(w>>(8-4*ch)) & 0x0F
+			v := ((n & 0x07) << 1) | (n >> 3)
+			rgb[ch] = v * 17
+		}
+		result[i] = color.RGBA{rgb[0], rgb[1], rgb[2], 0xFF}
+	}
+	return result
+}
+
+func decodeSTScreen(res uint16, palette []byte, screen []byte) (*PlanarImage, error) {
+	if int(res) >= len(stResolutions) {
+		return nil, fmt.Errorf("%w: unknown resolution %d", ErrAtariSTInvalid, res)
+	}
+	r := stResolutions[res]
+	return DecodeRawPlanar(screen, r.width, r.height, r.numPlanes, InterleaveWord, stPaletteToColors(palette, 1<<r.numPlanes))
+}
+
+// DecodeDegas decodes an uncompressed Degas or Degas Elite picture.
+func DecodeDegas(data []byte) (*PlanarImage, error) {
+	if len(data) < degasHeaderLen+stScreenSize {
+		return nil, fmt.Errorf("%w: Degas file too short (%d bytes)", ErrAtariSTInvalid, len(data))
+	}
+	res := binary.BigEndian.Uint16(data[0:2])
+	if res&0x8000 != 0 {
+		return nil, fmt.Errorf("%w: compressed Degas Elite pictures are not supported", ErrAtariSTInvalid)
+	}
+	return decodeSTScreen(res, data[2:34], data[degasHeaderLen:degasHeaderLen+stScreenSize])
+}
+
+// DecodeNEOchrome decodes a NEOchrome picture.
+func DecodeNEOchrome(data []byte) (*PlanarImage, error) {
+	if len(data) < neoHeaderLen+stScreenSize {
+		return nil, fmt.Errorf("%w: NEOchrome file too short (%d bytes)", ErrAtariSTInvalid, len(data))
+	}
+	res := binary.BigEndian.Uint16(data[2:4])
+	return decodeSTScreen(res, data[4:36], data[neoHeaderLen:neoHeaderLen+stScreenSize])
+}
+
+func LoadDegas(filename string) (*PlanarImage, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeDegas(data)
+}
+
+func LoadNEOchrome(filename string) (*PlanarImage, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeNEOchrome(data)
+}
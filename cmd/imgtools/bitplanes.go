@@ -13,6 +13,22 @@ type Bitplane struct {
 	height uint64
 }
 
+func NewBitplane(width, height uint64) *Bitplane {
+	result := Bitplane{
+		data:   make([][]byte, height),
+		width:  width,
+		height: height,
+	}
+	for i := range result.data {
+		result.data[i] = make([]byte, result.GetWidthBpBytes())
+	}
+	return &result
+}
+
+func (b *Bitplane) GetWidthPx() uint64 {
+	return b.width
+}
+
 func (b *Bitplane) GetWidthBpBytes() uint64 {
 	return uint64(math.Ceil(float64(b.width) / 8))
 }
@@ -25,17 +41,73 @@ func (b *Bitplane) GetTotalSize() uint64 {
 	return b.GetHeightPx() * b.GetWidthBpBytes()
 }
 
+func (b *Bitplane) GetPixel(x, y uint64) uint8 {
+	return (b.data[y][x/8] >> (7 - x%8)) & 0x01
+}
+
+func (b *Bitplane) SetPixel(x, y uint64, bit uint8) {
+	mask := uint8(0x80) >> (x % 8)
+	if bit&0x01 != 0 {
+		b.data[y][x/8] |= mask
+	} else {
+		b.data[y][x/8] &= ^mask
+	}
+}
+
+// DeltaEncode replaces every row but the first with its XOR against the row above it.
 func (b *Bitplane) DeltaEncode() {
-	deltaBuffer := make([]byte, b.GetWidthBpBytes())
-	for i, line := range b.data[1:] {
-		for j, v := range line {
-			deltaBuffer[j] = b.data[i][j] ^ v
+	for i := len(b.data) - 1; i > 0; i-- {
+		for j := range b.data[i] {
+			b.data[i][j] ^= b.data[i-1][j]
 		}
-		if i > 0 {
-			copy(b.data[i], deltaBuffer)
+	}
+}
+
+// DeltaDecode undoes DeltaEncode.
+func (b *Bitplane) DeltaDecode() {
+	for i := 1; i < len(b.data); i++ {
+		for j := range b.data[i] {
+			b.data[i][j] ^= b.data[i-1][j]
 		}
 	}
-	b.data[len(b.data)-1] = deltaBuffer
+}
+
+func (b *Bitplane) Clone() *Bitplane {
+	result := *b
+	result.data = make([][]byte, len(b.data))
+	for i, row := range b.data {
+		result.data[i] = append([]byte(nil), row...)
+	}
+	return &result
+}
+
+// XOR replaces the bitplane with its XOR against another one of the same size.
+func (b *Bitplane) XOR(other *Bitplane) error {
+	if b.width != other.width || b.height != other.height {
+		return fmt.Errorf("cannot XOR a %dx%d bitplane with a %dx%d one", b.width, b.height, other.width, other.height)
+	}
+	for i := range b.data {
+		for j := range b.data[i] {
+			b.data[i][j] ^= other.data[i][j]
+		}
+	}
+	return nil
+}
+
+// Crop returns a copy of the top left width x height pixels of the bitplane, e.g. to drop the padding added by
+// conversion to crumbs.
+func (b *Bitplane) Crop(width, height uint64) (*Bitplane, error) {
+	if width > b.width || height > b.height {
+		return nil, fmt.Errorf("cannot crop a %dx%d bitplane to %dx%d", b.width, b.height, width, height)
+	}
+	result := NewBitplane(width, height)
+	for y := range result.data {
+		copy(result.data[y], b.data[y])
+		if width%8 != 0 {
+			result.data[y][len(result.data[y])-1] &= 0xFF << (8 - width%8)
+		}
+	}
+	return result, nil
 }
 
 type PlanarImage struct {
@@ -43,12 +115,115 @@ type PlanarImage struct {
 	palette color.Palette
 	width   uint64
 	height  uint64
+	// optional transparency mask, kept apart from the color bitplanes; see SetMask
+	mask *Bitplane
+}
+
+func NewPlanarImageFromBitplanes(planes []Bitplane, palette color.Palette) (*PlanarImage, error) {
+	if len(planes) == 0 {
+		return nil, fmt.Errorf("cannot build a planar image out of zero bitplanes")
+	}
+	if len(planes) > 16 {
+		return nil, fmt.Errorf("cannot build a planar image out of %d bitplanes (max 16)", len(planes))
+	}
+	width, height := planes[0].width, planes[0].height
+	for i, bp := range planes {
+		if bp.width != width || bp.height != height {
+			return nil, fmt.Errorf("bitplane %d has size %dx%d, expected %dx%d", i, bp.width, bp.height, width, height)
+		}
+	}
+	if palette == nil {
+		palette = GrayscalePalette(1 << len(planes))
+	}
+	return &PlanarImage{
+		planes:  planes,
+		palette: palette,
+		width:   width,
+		height:  height,
+	}, nil
 }
 
 func (i PlanarImage) GetBitplanes() []Bitplane {
 	return i.planes
 }
 
+func (i PlanarImage) GetPalette() color.Palette {
+	return i.palette
+}
+
+func (i PlanarImage) GetWidthPx() uint64 {
+	return i.width
+}
+
+func (i PlanarImage) GetHeightPx() uint64 {
+	return i.height
+}
+
+// Clone returns a deep copy of the image, so that its bitplanes can be modified (e.g. delta-encoded) independently.
+func (i PlanarImage) Clone() *PlanarImage {
+	result := i
+	result.planes = make([]Bitplane, len(i.planes))
+	for b := range i.planes {
+		result.planes[b] = *i.planes[b].Clone()
+	}
+	if i.mask != nil {
+		result.mask = i.mask.Clone()
+	}
+	return &result
+}
+
+// XOR replaces every bitplane of the image with its XOR against the same bitplane of another image, which must have
+// the same size and number of bitplanes. Masks are XORed too, so either both images or neither must have one.
+func (i PlanarImage) XOR(other *PlanarImage) error {
+	if len(i.planes) != len(other.planes) {
+		return fmt.Errorf("cannot XOR an image with %d bitplanes with one with %d", len(i.planes), len(other.planes))
+	}
+	if (i.mask == nil) != (other.mask == nil) {
+		return fmt.Errorf("cannot XOR an image with a mask with one without")
+	}
+	for b := range i.planes {
+		if err := i.planes[b].XOR(&other.planes[b]); err != nil {
+			return err
+		}
+	}
+	if i.mask != nil {
+		return i.mask.XOR(other.mask)
+	}
+	return nil
+}
+
+func (i PlanarImage) ColorIndexAt(x, y uint64) uint16 {
+	var idx uint16
+	for b := range i.planes {
+		idx |= uint16(i.planes[b].GetPixel(x, y)) << b
+	}
+	return idx
+}
+
+func (i PlanarImage) ToPaletted() *image.Paletted {
+	result := image.NewPaletted(image.Rect(0, 0, int(i.width), int(i.height)), i.palette)
+	for y := uint64(0); y < i.height; y++ {
+		for x := uint64(0); x < i.width; x++ {
+			result.SetColorIndex(int(x), int(y), uint8(i.ColorIndexAt(x, y)))
+		}
+	}
+	return result
+}
+
+// GrayscalePalette returns a linear ramp of numColors grays from black to white, used whenever an image
+// format does not carry a palette of its own.
+func GrayscalePalette(numColors int) color.Palette {
+	result := make(color.Palette, numColors)
+	for i := range result {
+		v := uint8(0)
+		if numColors > 1 {
+			v = uint8(i * 255 / (numColors - 1))
+		}
+		result[i] = color.Gray{Y: v}
+	}
+	return result
+}
+
 func NewPlanarImage(im image.PalettedImage) (*PlanarImage, error) {
 	if im == nil {
 		panic("im is nil")
@@ -57,7 +232,7 @@ func NewPlanarImage(im image.PalettedImage) (*PlanarImage, error) {
 	width := bounds.Max.X - bounds.Min.X
 	height := bounds.Max.Y - bounds.Min.Y
 	numColors := len(im.ColorModel().(color.Palette))
-	numBitplanes := int(math.Ceil(math.Log2(float64(numColors))))
+	numBitplanes := numBitplanesForColors(numColors)
 
 	if numBitplanes > 16 {
 		return nil, fmt.Errorf("input image has too many colors! (how in the world did you load an image with %d colors, which is more than 65536?)", numColors)
@@ -0,0 +1,268 @@
+package imgtools
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Windows/OS2 BMP support, restricted to 1, 4 and 8-bit indexed images (uncompressed, RLE4 or RLE8).
+
+const (
+	bmpFileHeaderLen    = 14
+	bmpCoreHeaderLen    = 12
+	bmpInfoHeaderMinLen = 40
+
+	bmpCompressionRGB  = 0
+	bmpCompressionRLE8 = 1
+	bmpCompressionRLE4 = 2
+
+	bmpMaxDimension = 1 << 15
+)
+
+var (
+	ErrBMPInvalid     = errors.New("invalid BMP data")
+	ErrBMPUnsupported = errors.New("unsupported BMP variant")
+)
+
+func init() {
+	image.RegisterFormat("bmp", "BM", DecodeBMP, DecodeBMPConfig)
+}
+
+type bmpHeader struct {
+	dataOffset  uint32
+	width       int
+	height      int
+	topDown     bool
+	bpp         int
+	compression uint32
+	palette     color.Palette
+}
+
+func readBMPHeader(r io.Reader) (*bmpHeader, uint32, error) {
+	var fileHdr [bmpFileHeaderLen + 4]byte
+	if _, err := io.ReadFull(r, fileHdr[:]); err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrBMPInvalid, err)
+	}
+	if string(fileHdr[0:2]) != "BM" {
+		return nil, 0, fmt.Errorf("%w: not a BMP file", ErrBMPInvalid)
+	}
+	hdr := bmpHeader{dataOffset: binary.LittleEndian.Uint32(fileHdr[10:14])}
+	infoLen := binary.LittleEndian.Uint32(fileHdr[14:18])
+	if infoLen != bmpCoreHeaderLen && (infoLen < bmpInfoHeaderMinLen || infoLen > 1024) {
+		return nil, 0, fmt.Errorf("%w: unknown info header size %d", ErrBMPUnsupported, infoLen)
+	}
+	info := make([]byte, infoLen-4)
+	if _, err := io.ReadFull(r, info); err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrBMPInvalid, err)
+	}
+
+	var numColors uint32
+	paletteEntryLen := 4
+	if infoLen == bmpCoreHeaderLen {
+		hdr.width = int(binary.LittleEndian.Uint16(info[0:2]))
+		hdr.height = int(binary.LittleEndian.Uint16(info[2:4]))
+		hdr.bpp = int(binary.LittleEndian.Uint16(info[6:8]))
+		paletteEntryLen = 3
+	} else {
+		hdr.width = int(int32(binary.LittleEndian.Uint32(info[0:4])))
+		hdr.height = int(int32(binary.LittleEndian.Uint32(info[4:8])))
+		hdr.bpp = int(binary.LittleEndian.Uint16(info[10:12]))
+		hdr.compression = binary.LittleEndian.Uint32(info[12:16])
+		numColors = binary.LittleEndian.Uint32(info[28:32])
+	}
+	if hdr.height < 0 {
+		hdr.height = -hdr.height
+		hdr.topDown = true
+	}
+
+	if hdr.bpp != 1 && hdr.bpp != 4 && hdr.bpp != 8 {
+		return nil, 0, fmt.Errorf("%w: %d bits per pixel (only 1, 4 and 8-bit indexed images are supported)", ErrBMPUnsupported, hdr.bpp)
+	}
+	switch hdr.compression {
+	case bmpCompressionRGB:
+	case bmpCompressionRLE8:
+		if hdr.bpp != 8 {
+			return nil, 0, fmt.Errorf("%w: RLE8 compression with %d bits per pixel", ErrBMPInvalid, hdr.bpp)
+		}
+	case bmpCompressionRLE4:
+		if hdr.bpp != 4 {
+			return nil, 0, fmt.Errorf("%w: RLE4 compression with %d bits per pixel", ErrBMPInvalid, hdr.bpp)
+		}
+	default:
+		return nil, 0, fmt.Errorf("%w: compression method %d", ErrBMPUnsupported, hdr.compression)
+	}
+	if hdr.width <= 0 || hdr.height == 0 || hdr.width > bmpMaxDimension || hdr.height > bmpMaxDimension {
+		return nil, 0, fmt.Errorf("%w: image size %dx%d", ErrBMPInvalid, hdr.width, hdr.height)
+	}
+	if hdr.width*hdr.height > maxDecodedPixels {
+		return nil, 0, fmt.Errorf("%w: image size %dx%d is over the limit of %d pixels", ErrBMPUnsupported, hdr.width, hdr.height, maxDecodedPixels)
+	}
+
+	if numColors == 0 || numColors > 1<<hdr.bpp {
+		numColors = 1 << hdr.bpp
+	}
+	pal := make([]byte, int(numColors)*paletteEntryLen)
+	if _, err := io.ReadFull(r, pal); err != nil {
+		return nil, 0, fmt.Errorf("%w: palette is truncated", ErrBMPInvalid)
+	}
+	for i := 0; i < len(pal); i += paletteEntryLen {
+		hdr.palette = append(hdr.palette, color.RGBA{pal[i+2], pal[i+1], pal[i], 0xFF})
+	}
+
+	bytesRead := uint32(bmpFileHeaderLen) + infoLen + uint32(len(pal))
+	return &hdr, bytesRead, nil
+}
+
+func DecodeBMPConfig(r io.Reader) (image.Config, error) {
+	hdr, _, err := readBMPHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: hdr.palette,
+		Width:      hdr.width,
+		Height:     hdr.height,
+	}, nil
+}
+
+func DecodeBMP(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	hdr, bytesRead, err := readBMPHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if hdr.dataOffset < bytesRead {
+		return nil, fmt.Errorf("%w: pixel data offset %d points inside the header", ErrBMPInvalid, hdr.dataOffset)
+	}
+	if _, err := br.Discard(int(hdr.dataOffset - bytesRead)); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBMPInvalid, err)
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, hdr.width, hdr.height), hdr.palette)
+	if hdr.compression == bmpCompressionRGB {
+		err = decodeBMPUncompressed(br, hdr, img)
+	} else {
+		err = decodeBMPRLE(br, hdr, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Out-of-range indices would make the image unusable as a color.Palette-indexed image.
+	for i, idx := range img.Pix {
+		if int(idx) >= len(hdr.palette) {
+			img.Pix[i] = 0
+		}
+	}
+	return img, nil
+}
+
+func (hdr *bmpHeader) rowToY(row int) int {
+	if hdr.topDown {
+		return row
+	}
+	return hdr.height - 1 - row
+}
+
+func decodeBMPUncompressed(r io.Reader, hdr *bmpHeader, img *image.Paletted) error {
+	stride := ((hdr.width*hdr.bpp + 31) / 32) * 4
+	line := make([]byte, stride)
+	pixelsPerByte := 8 / hdr.bpp
+	mask := uint8(1<<hdr.bpp) - 1
+	for row := range hdr.height {
+		if _, err := io.ReadFull(r, line); err != nil {
+			return fmt.Errorf("%w: pixel data ended early at row %d", ErrBMPInvalid, row)
+		}
+		y := hdr.rowToY(row)
+		for x := range hdr.width {
+			b := line[x/pixelsPerByte]
+			shift := (pixelsPerByte - 1 - x%pixelsPerByte) * hdr.bpp
+			img.SetColorIndex(x, y, (b>>shift)&mask)
+		}
+	}
+	return nil
+}
+
+func decodeBMPRLE(r *bufio.Reader, hdr *bmpHeader, img *image.Paletted) error {
+	x, row := 0, 0
+	put := func(idx uint8) {
+		if x < hdr.width && row < hdr.height {
+			img.SetColorIndex(x, hdr.rowToY(row), idx)
+		}
+		x++
+	}
+	readByte := func() (uint8, error) {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, fmt.Errorf("%w: RLE data ended early at row %d", ErrBMPInvalid, row)
+		}
+		return b, nil
+	}
+
+	for row < hdr.height {
+		count, err := readByte()
+		if err != nil {
+			return err
+		}
+		value, err := readByte()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			for i := range int(count) {
+				if hdr.bpp == 8 {
+					put(value)
+				} else if i%2 == 0 {
+					put(value >> 4)
+				} else {
+					put(value & 0x0F)
+				}
+			}
+			continue
+		}
+
+		switch value {
+		case 0: // end of line
+			x = 0
+			row++
+		case 1: // end of bitmap
+			return nil
+		case 2: // delta
+			dx, err := readByte()
+			if err != nil {
+				return err
+			}
+			dy, err := readByte()
+			if err != nil {
+				return err
+			}
+			x += int(dx)
+			row += int(dy)
+		default: // absolute run
+			n := int(value)
+			numBytes := n
+			if hdr.bpp == 4 {
+				numBytes = (n + 1) / 2
+			}
+			data := make([]byte, numBytes+numBytes%2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return fmt.Errorf("%w: RLE data ended early at row %d", ErrBMPInvalid, row)
+			}
+			for i := range n {
+				if hdr.bpp == 8 {
+					put(data[i])
+				} else if i%2 == 0 {
+					put(data[i/2] >> 4)
+				} else {
+					put(data[i/2] & 0x0F)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -78,8 +78,9 @@ func ImagePlanarToCrumb(pi *PlanarImage) *CrumbImage {
 }
 
 func BitplaneToCrumbPlane(bp *Bitplane) *CrumbPlane {
+	// Crumb rows always cover whole bitplane bytes, so that decoders can derive the width from the width in tiles.
 	crumbsH := int(math.Ceil(float64(bp.height) / 2))
-	crumbsW := int(math.Ceil(float64(bp.width) / 2))
+	crumbsW := int(bp.GetWidthBpBytes()) * 4
 
 	result := CrumbPlane{
 		crumbs: make([][]Crumb, crumbsH),
@@ -105,7 +106,7 @@ func bpRowPairToCrumbRow(bpRowPair [2][]byte, crumbsW uint64) []Crumb {
 	result := make([]Crumb, crumbsW)
 	for i, b := range bpRowPair[0] {
 		crumbOffs := i * 4
-		for ii := 0; ii < 3 && crumbOffs < int(crumbsW); ii++ {
+		for ii := 0; ii < 4 && crumbOffs < int(crumbsW); ii++ {
 			result[crumbOffs] |= Crumb((b & 0xC0) >> 4)
 			crumbOffs++
 			b <<= 2
@@ -113,7 +114,7 @@ func bpRowPairToCrumbRow(bpRowPair [2][]byte, crumbsW uint64) []Crumb {
 	}
 	for i, b := range bpRowPair[1] {
 		crumbOffs := i * 4
-		for ii := 0; ii < 3 && crumbOffs < int(crumbsW); ii++ {
+		for ii := 0; ii < 4 && crumbOffs < int(crumbsW); ii++ {
 			result[crumbOffs] |= Crumb((b & 0xC0) >> 6)
 			crumbOffs++
 			b <<= 2
@@ -121,3 +122,23 @@ func bpRowPairToCrumbRow(bpRowPair [2][]byte, crumbsW uint64) []Crumb {
 	}
 	return result
 }
+
+// CrumbPlaneToBitplane unpacks the crumbs of a plane back into pixel rows. The resulting bitplane has the size of the
+// crumb matrix rounded up to whole bytes, which may include padding beyond the original image's width and height.
+func CrumbPlaneToBitplane(crp *CrumbPlane) *Bitplane {
+	var crumbsW int
+	if len(crp.crumbs) > 0 {
+		crumbsW = len(crp.crumbs[0])
+	}
+	result := NewBitplane(uint64(crumbsW+3)/4*8, uint64(len(crp.crumbs))*2)
+	for i, row := range crp.crumbs {
+		for j, c := range row {
+			x, y := uint64(j)*2, uint64(i)*2
+			result.SetPixel(x, y, uint8(c>>3))
+			result.SetPixel(x+1, y, uint8(c>>2))
+			result.SetPixel(x, y+1, uint8(c>>1))
+			result.SetPixel(x+1, y+1, uint8(c))
+		}
+	}
+	return result
+}
@@ -0,0 +1,223 @@
+package imgtools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PaletteOrder selects how indices are assigned when building a palette out of the colors of a non-paletted image.
+type PaletteOrder int
+
+const (
+	// colors are numbered in the order they are first seen, scanning rows top to bottom
+	PaletteOrderFirstSeen PaletteOrder = iota
+	// the most frequent color gets index 0, ties broken by first appearance
+	PaletteOrderFrequency
+	// darkest color first, ties broken by RGBA value
+	PaletteOrderLuminance
+)
+
+const maxExactPaletteColors = 256
+
+var ErrTooManyColors = errors.New("image has too many distinct colors for an exact palette")
+
+var paletteOrderNames = map[PaletteOrder]string{
+	PaletteOrderFirstSeen: "firstseen",
+	PaletteOrderFrequency: "frequency",
+	PaletteOrderLuminance: "luminance",
+}
+
+func ParsePaletteOrder(name string) (PaletteOrder, error) {
+	name = strings.ToLower(name)
+	for o, n := range paletteOrderNames {
+		if n == name {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown palette order '%s'", name)
+}
+
+func (o PaletteOrder) String() string {
+	if n, ok := paletteOrderNames[o]; ok {
+		return n
+	}
+	return fmt.Sprintf("PaletteOrder(%d)", int(o))
+}
+
+type colorKey [4]uint32
+
+func makeColorKey(c color.Color) colorKey {
+	r, g, b, a := c.RGBA()
+	return colorKey{r, g, b, a}
+}
+
+func (k colorKey) luma() uint32 {
+	return (299*k[0] + 587*k[1] + 114*k[2]) / 1000
+}
+
+func (k colorKey) toColor() color.Color {
+	return color.RGBA64{uint16(k[0]), uint16(k[1]), uint16(k[2]), uint16(k[3])}
+}
+
+type colorStat struct {
+	key       colorKey
+	count     uint64
+	firstSeen int
+}
+
+// ConvertToExactPalette losslessly converts an image with few distinct colors into a paletted image. If refPalette is
+// not nil, it is used as the palette and every color in the image must be present in it; otherwise a palette is built
+// out of the image's own colors, sorted as per order.
+func ConvertToExactPalette(im image.Image, order PaletteOrder, refPalette color.Palette) (*image.Paletted, error) {
+	bounds := im.Bounds()
+	stats := make(map[colorKey]*colorStat)
+	var statList []*colorStat
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			k := makeColorKey(im.At(x, y))
+			if s, ok := stats[k]; ok {
+				s.count++
+				continue
+			}
+			if refPalette == nil && len(stats) >= maxExactPaletteColors {
+				return nil, fmt.Errorf("%w (more than %d)", ErrTooManyColors, maxExactPaletteColors)
+			}
+			s := &colorStat{key: k, count: 1, firstSeen: len(statList)}
+			stats[k] = s
+			statList = append(statList, s)
+		}
+	}
+
+	var pal color.Palette
+	indices := make(map[colorKey]uint8, len(stats))
+	if refPalette != nil {
+		if len(refPalette) > maxExactPaletteColors {
+			return nil, fmt.Errorf("reference palette has %d colors (max %d)", len(refPalette), maxExactPaletteColors)
+		}
+		pal = refPalette
+		for i := len(refPalette) - 1; i >= 0; i-- {
+			indices[makeColorKey(refPalette[i])] = uint8(i)
+		}
+		for _, s := range statList {
+			if _, ok := indices[s.key]; !ok {
+				c := s.key.toColor().(color.RGBA64)
+				return nil, fmt.Errorf("color #%02x%02x%02x (alpha %d) is not in the reference palette", c.R>>8, c.G>>8, c.B>>8, c.A>>8)
+			}
+		}
+	} else {
+		switch order {
+		case PaletteOrderFrequency:
+			slices.SortStableFunc(statList, func(a, b *colorStat) int {
+				if a.count != b.count {
+					if a.count > b.count {
+						return -1
+					}
+					return 1
+				}
+				return a.firstSeen - b.firstSeen
+			})
+		case PaletteOrderLuminance:
+			slices.SortStableFunc(statList, func(a, b *colorStat) int {
+				if la, lb := a.key.luma(), b.key.luma(); la != lb {
+					return int(la) - int(lb)
+				}
+				return slices.Compare(a.key[:], b.key[:])
+			})
+		}
+		for i, s := range statList {
+			pal = append(pal, s.key.toColor())
+			indices[s.key] = uint8(i)
+		}
+	}
+
+	result := image.NewPaletted(bounds, pal)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			result.SetColorIndex(x, y, indices[makeColorKey(im.At(x, y))])
+		}
+	}
+	return result, nil
+}
+
+const actFileWithTrailerLen = 256*3 + 4
+
+// LoadPaletteFile reads a palette from a JASC-PAL file, a raw file of RGB triplets (.act/.pal, including Photoshop
+// .act files with a color count trailer) or the palette of any paletted image file.
+func LoadPaletteFile(filename string) (color.Palette, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte("JASC-PAL")) {
+		pal, err := parseJASCPalette(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse palette file '%s': %w", filename, err)
+		}
+		return pal, nil
+	}
+	if im, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+		if pal, ok := im.ColorModel().(color.Palette); ok {
+			return pal, nil
+		}
+		return nil, fmt.Errorf("image file '%s' has no palette", filename)
+	}
+	if len(data) == actFileWithTrailerLen {
+		// Photoshop .act files may end with a big-endian u16 color count and a u16 transparent index
+		numColors := int(binary.BigEndian.Uint16(data[768:770]))
+		if numColors < 1 || numColors > 256 {
+			return nil, fmt.Errorf("palette file '%s' has an invalid color count of %d", filename, numColors)
+		}
+		data = data[:numColors*3]
+	}
+	if len(data) == 0 || len(data)%3 != 0 || len(data) > maxExactPaletteColors*3 {
+		return nil, fmt.Errorf("'%s' is not a recognized palette file", filename)
+	}
+	var pal color.Palette
+	for i := 0; i < len(data); i += 3 {
+		pal = append(pal, color.RGBA{data[i], data[i+1], data[i+2], 0xFF})
+	}
+	return pal, nil
+}
+
+func parseJASCPalette(data []byte) (color.Palette, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var lines []string
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 3 {
+		return nil, errors.New("JASC palette header is truncated")
+	}
+	numColors, err := strconv.Atoi(lines[2])
+	if err != nil || numColors < 1 || numColors > maxExactPaletteColors || len(lines) < 3+numColors {
+		return nil, errors.New("JASC palette has an invalid color count")
+	}
+	pal := make(color.Palette, numColors)
+	for i := range pal {
+		fields := strings.Fields(lines[3+i])
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("JASC palette entry %d is malformed", i)
+		}
+		var rgb [3]uint8
+		for ch := range rgb {
+			v, err := strconv.ParseUint(fields[ch], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("JASC palette entry %d is malformed", i)
+			}
+			rgb[ch] = uint8(v)
+		}
+		pal[i] = color.RGBA{rgb[0], rgb[1], rgb[2], 0xFF}
+	}
+	return pal, nil
+}
@@ -0,0 +1,372 @@
+package imgtools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+)
+
+// Amiga IFF ILBM support. Only plain indexed images are handled (no HAM, EHB or 24-bit deep ILBMs); CAMG and other
+// chunks not needed to reconstruct the bitplanes are skipped.
+
+const (
+	ilbmMaskingNone        = 0
+	ilbmMaskingHasMask     = 1
+	ilbmCompressionNone    = 0
+	ilbmCompressionByteRun = 1
+)
+
+var (
+	ErrILBMInvalid     = errors.New("invalid ILBM data")
+	ErrILBMUnsupported = errors.New("unsupported ILBM variant")
+)
+
+type ilbmHeader struct {
+	Width, Height    uint16
+	X, Y             int16
+	NumPlanes        uint8
+	Masking          uint8
+	Compression      uint8
+	Pad1             uint8
+	TransparentColor uint16
+	XAspect, YAspect uint8
+	PageWidth        int16
+	PageHeight       int16
+}
+
+func init() {
+	image.RegisterFormat("ilbm", "FORM????ILBM", DecodeILBM, DecodeILBMConfig)
+}
+
+type ilbmChunks struct {
+	header  *ilbmHeader
+	palette color.Palette
+	body    []byte
+}
+
+func readILBMChunks(r io.Reader, stopAtBody bool) (*ilbmChunks, error) {
+	var formHdr [12]byte
+	if _, err := io.ReadFull(r, formHdr[:]); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrILBMInvalid, err)
+	}
+	if string(formHdr[0:4]) != "FORM" || string(formHdr[8:12]) != "ILBM" {
+		return nil, fmt.Errorf("%w: not an IFF ILBM file", ErrILBMInvalid)
+	}
+
+	var result ilbmChunks
+	for {
+		var chunkHdr [8]byte
+		if _, err := io.ReadFull(r, chunkHdr[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("%w: %w", ErrILBMInvalid, err)
+		}
+		id := string(chunkHdr[0:4])
+		size := binary.BigEndian.Uint32(chunkHdr[4:8])
+		if size > 1<<26 {
+			return nil, fmt.Errorf("%w: chunk '%s' is too large (%d bytes)", ErrILBMInvalid, id, size)
+		}
+		padded := int64(size) + int64(size&1)
+
+		switch id {
+		case "BMHD":
+			if size < 20 {
+				return nil, fmt.Errorf("%w: BMHD chunk too short", ErrILBMInvalid)
+			}
+			var hdr ilbmHeader
+			if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrILBMInvalid, err)
+			}
+			result.header = &hdr
+			padded -= 20
+		case "CMAP":
+			cmap := make([]byte, size)
+			if _, err := io.ReadFull(r, cmap); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrILBMInvalid, err)
+			}
+			for i := 0; i+2 < len(cmap); i += 3 {
+				result.palette = append(result.palette, color.RGBA{cmap[i], cmap[i+1], cmap[i+2], 0xFF})
+			}
+			padded -= int64(size)
+		case "BODY":
+			if stopAtBody {
+				return &result, nil
+			}
+			result.body = make([]byte, size)
+			if _, err := io.ReadFull(r, result.body); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrILBMInvalid, err)
+			}
+			padded -= int64(size)
+		}
+		if _, err := io.CopyN(io.Discard, r, padded); err != nil {
+			if errors.Is(err, io.EOF) && id == "BODY" {
+				break
+			}
+			return nil, fmt.Errorf("%w: %w", ErrILBMInvalid, err)
+		}
+	}
+	return &result, nil
+}
+
+func (c *ilbmChunks) checkHeader() error {
+	if c.header == nil {
+		return fmt.Errorf("%w: missing BMHD chunk", ErrILBMInvalid)
+	}
+	if c.header.NumPlanes == 0 || c.header.NumPlanes > 8 {
+		return fmt.Errorf("%w: %d bitplanes", ErrILBMUnsupported, c.header.NumPlanes)
+	}
+	if c.header.Compression > ilbmCompressionByteRun {
+		return fmt.Errorf("%w: compression method %d", ErrILBMUnsupported, c.header.Compression)
+	}
+	if c.header.Width == 0 || c.header.Height == 0 {
+		return fmt.Errorf("%w: image has zero size", ErrILBMInvalid)
+	}
+	if int(c.header.Width)*int(c.header.Height) > maxDecodedPixels {
+		return fmt.Errorf("%w: image size %dx%d is over the limit of %d pixels", ErrILBMUnsupported, c.header.Width, c.header.Height, maxDecodedPixels)
+	}
+	return nil
+}
+
+// paddedPalette returns the CMAP palette, padded with black up to one entry per possible color index.
+func (c *ilbmChunks) paddedPalette() color.Palette {
+	numColors := 1 << c.header.NumPlanes
+	pal := make(color.Palette, 0, numColors)
+	for i := 0; i < numColors; i++ {
+		if i < len(c.palette) {
+			pal = append(pal, c.palette[i])
+		} else {
+			pal = append(pal, color.RGBA{0, 0, 0, 0xFF})
+		}
+	}
+	return pal
+}
+
+func DecodeILBMConfig(r io.Reader) (image.Config, error) {
+	chunks, err := readILBMChunks(r, true)
+	if err != nil {
+		return image.Config{}, err
+	}
+	if err := chunks.checkHeader(); err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{
+		ColorModel: chunks.paddedPalette(),
+		Width:      int(chunks.header.Width),
+		Height:     int(chunks.header.Height),
+	}, nil
+}
+
+func DecodeILBM(r io.Reader) (image.Image, error) {
+	pi, err := DecodeILBMPlanar(r)
+	if err != nil {
+		return nil, err
+	}
+	return pi.ToPaletted(), nil
+}
+
+// DecodeILBMPlanar decodes an ILBM file straight into a PlanarImage, without going through image.Paletted.
+func DecodeILBMPlanar(r io.Reader) (*PlanarImage, error) {
+	chunks, err := readILBMChunks(r, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := chunks.checkHeader(); err != nil {
+		return nil, err
+	}
+	hdr := chunks.header
+
+	width, height := uint64(hdr.Width), uint64(hdr.Height)
+	rowBytes := int((width + 15) / 16 * 2)
+	numRowPlanes := int(hdr.NumPlanes)
+	if hdr.Masking == ilbmMaskingHasMask {
+		numRowPlanes++
+	}
+	if hdr.Compression == ilbmCompressionNone && len(chunks.body) < rowBytes*numRowPlanes*int(height) {
+		return nil, fmt.Errorf("%w: BODY has %d bytes, expected %d", ErrILBMInvalid, len(chunks.body), rowBytes*numRowPlanes*int(height))
+	}
+
+	planes := make([]Bitplane, hdr.NumPlanes)
+	for p := range planes {
+		planes[p] = *NewBitplane(width, height)
+	}
+	lastByteMask := ^uint8(0) << ((8 - width%8) % 8)
+
+	body := bytes.NewReader(chunks.body)
+	row := make([]byte, rowBytes)
+	for y := range height {
+		for p := 0; p < numRowPlanes; p++ {
+			if hdr.Compression == ilbmCompressionByteRun {
+				err = unpackByteRun1(body, row)
+			} else {
+				_, err = io.ReadFull(body, row)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: BODY ended early at row %d, plane %d", ErrILBMInvalid, y, p)
+			}
+			if p >= int(hdr.NumPlanes) {
+				continue
+			}
+			dest := planes[p].data[y]
+			copy(dest, row)
+			dest[len(dest)-1] &= lastByteMask
+		}
+	}
+	return NewPlanarImageFromBitplanes(planes, chunks.paddedPalette())
+}
+
+func unpackByteRun1(r *bytes.Reader, dest []byte) error {
+	for pos := 0; pos < len(dest); {
+		n, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case n < 128:
+			count := int(n) + 1
+			if pos+count > len(dest) {
+				return ErrILBMInvalid
+			}
+			if _, err := io.ReadFull(r, dest[pos:pos+count]); err != nil {
+				return err
+			}
+			pos += count
+		case n > 128:
+			count := 257 - int(n)
+			if pos+count > len(dest) {
+				return ErrILBMInvalid
+			}
+			v, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			for i := range count {
+				dest[pos+i] = v
+			}
+			pos += count
+		}
+	}
+	return nil
+}
+
+func packByteRun1(dest *bytes.Buffer, src []byte) {
+	for pos := 0; pos < len(src); {
+		runLen := 1
+		for pos+runLen < len(src) && runLen < 128 && src[pos+runLen] == src[pos] {
+			runLen++
+		}
+		if runLen >= 3 {
+			dest.WriteByte(uint8(257 - runLen))
+			dest.WriteByte(src[pos])
+			pos += runLen
+			continue
+		}
+
+		litLen := 0
+		for pos+litLen < len(src) && litLen < 128 {
+			if pos+litLen+2 < len(src) && src[pos+litLen] == src[pos+litLen+1] && src[pos+litLen] == src[pos+litLen+2] {
+				break
+			}
+			litLen++
+		}
+		dest.WriteByte(uint8(litLen - 1))
+		dest.Write(src[pos : pos+litLen])
+		pos += litLen
+	}
+}
+
+// EncodeILBM writes a planar image as an IFF ILBM file, optionally ByteRun1-compressed.
+func EncodeILBM(w io.Writer, pi *PlanarImage, compress bool) error {
+	if len(pi.planes) > 8 {
+		return fmt.Errorf("%w: %d bitplanes", ErrILBMUnsupported, len(pi.planes))
+	}
+	if pi.width > 0xFFFF || pi.height > 0xFFFF {
+		return fmt.Errorf("%w: image size %dx%d does not fit in BMHD", ErrILBMUnsupported, pi.width, pi.height)
+	}
+
+	// the page size fields are signed, so they can't describe pages as large as the largest images
+	hdr := ilbmHeader{
+		Width:      uint16(pi.width),
+		Height:     uint16(pi.height),
+		NumPlanes:  uint8(len(pi.planes)),
+		Masking:    ilbmMaskingNone,
+		XAspect:    1,
+		YAspect:    1,
+		PageWidth:  int16(min(pi.width, math.MaxInt16)),
+		PageHeight: int16(min(pi.height, math.MaxInt16)),
+	}
+	if compress {
+		hdr.Compression = ilbmCompressionByteRun
+	}
+
+	var bmhd bytes.Buffer
+	binary.Write(&bmhd, binary.BigEndian, &hdr)
+
+	var cmap bytes.Buffer
+	for i, c := range pi.palette {
+		if i >= 1<<len(pi.planes) {
+			break
+		}
+		r, g, b, _ := c.RGBA()
+		cmap.Write([]byte{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)})
+	}
+
+	var body bytes.Buffer
+	row := make([]byte, (pi.width+15)/16*2)
+	for y := range pi.height {
+		for _, bp := range pi.planes {
+			clear(row)
+			copy(row, bp.data[y])
+			if compress {
+				packByteRun1(&body, row)
+			} else {
+				body.Write(row)
+			}
+		}
+	}
+
+	var form bytes.Buffer
+	form.WriteString("ILBM")
+	for _, chunk := range []struct {
+		id   string
+		data []byte
+	}{{"BMHD", bmhd.Bytes()}, {"CMAP", cmap.Bytes()}, {"BODY", body.Bytes()}} {
+		form.WriteString(chunk.id)
+		binary.Write(&form, binary.BigEndian, uint32(len(chunk.data)))
+		form.Write(chunk.data)
+		if len(chunk.data)&1 != 0 {
+			form.WriteByte(0)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("FORM")
+	binary.Write(bw, binary.BigEndian, uint32(form.Len()))
+	bw.Write(form.Bytes())
+	return bw.Flush()
+}
+
+func SaveILBM(filename string, pi *PlanarImage, compress bool) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return EncodeILBM(f, pi, compress)
+}
+
+func LoadILBM(filename string) (*PlanarImage, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return DecodeILBMPlanar(bufio.NewReader(f))
+}
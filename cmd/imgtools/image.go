@@ -7,34 +7,44 @@ import (
 	"os"
 )
 
+// maxDecodedPixels bounds the size of the images the built-in decoders allocate, so that a tiny file with a corrupt
+// header can't make them allocate gigabytes. It is far above what the codecs can compress (2040x510 pixels).
+const maxDecodedPixels = 1 << 24
+
 func LoadImage(filename string) (image.PalettedImage, error) {
+	return LoadImageWithOptions(filename, PaletteOptions{})
+}
+
+func LoadImageWithOptions(filename string, opts PaletteOptions) (image.PalettedImage, error) {
 	reader, err := os.Open(filename)
-	defer reader.Close()
 	if err != nil {
 		return nil, err
 	}
+	defer reader.Close()
 	im, _, err := image.Decode(reader)
 	if err != nil {
 		return nil, err
 	}
 
-	if pim, ok := im.(image.PalettedImage); ok {
-		if _, ok = pim.ColorModel().(color.Palette); !ok {
-			return nil, fmt.Errorf("input image '%s' is not paletted", filename)
+	pim, ok := im.(image.PalettedImage)
+	if ok {
+		_, ok = pim.ColorModel().(color.Palette)
+	}
+	if !ok || opts.ReferencePalette != nil {
+		pim, err = convertToPaletted(im, opts)
+		if err != nil {
+			return nil, fmt.Errorf("could not build a palette for input image '%s': %w", filename, err)
 		}
-	} else {
-		return nil, fmt.Errorf("input image '%s' is not paletted", filename)
 	}
 
-	pim := im.(image.PalettedImage)
 	pal := pim.ColorModel().(color.Palette)
-	numColors := len(pal)
-	if numColors < 2 {
-		return nil, fmt.Errorf("input image '%s' only has %d color in palette (needs to have at least 2)", filename, len(pal))
-	}
-	if (numColors & (numColors - 1)) != 0 {
-		return nil, fmt.Errorf("input image '%s' has %d colors in palette (number of colors needs to be a power of 2)", filename, len(pal))
+	if len(pal) < 1 {
+		return nil, fmt.Errorf("input image '%s' has an empty palette", filename)
 	}
 
-	return pim, nil
+	padded, err := PadImagePalette(pim, opts)
+	if err != nil {
+		return nil, fmt.Errorf("input image '%s': %w", filename, err)
+	}
+	return padded, nil
 }
@@ -0,0 +1,55 @@
+package imgtools
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// TransparentIndex returns the first fully transparent color of a palette, such as one made transparent by a PNG tRNS
+// chunk or a GIF transparent index, or -1 if there is none.
+func TransparentIndex(pal color.Palette) int {
+	for i, c := range pal {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// TransparencyMask returns a 1bpp mask of the image, set for every pixel that isn't of color transparentIndex, as
+// used to cut out software sprites before drawing them.
+func (i PlanarImage) TransparencyMask(transparentIndex int) *Bitplane {
+	result := NewBitplane(i.width, i.height)
+	for y := range i.height {
+		for x := range i.width {
+			if int(i.ColorIndexAt(x, y)) != transparentIndex {
+				result.SetPixel(x, y, 1)
+			}
+		}
+	}
+	return result
+}
+
+// SetMask attaches a transparency mask to the image, or removes it with nil. The mask is not one of the color
+// bitplanes: it doesn't change the color indices of the image, and is only stored and compressed alongside them.
+func (i *PlanarImage) SetMask(mask *Bitplane) error {
+	if mask != nil && (mask.width != i.width || mask.height != i.height) {
+		return fmt.Errorf("mask has size %dx%d, expected %dx%d", mask.width, mask.height, i.width, i.height)
+	}
+	i.mask = mask
+	return nil
+}
+
+// GetMask returns the transparency mask of the image, or nil if it has none.
+func (i PlanarImage) GetMask() *Bitplane {
+	return i.mask
+}
+
+// GetBitplanesWithMask returns the bitplanes of the image in the order they are compressed and stored: the mask
+// first, if there is one, then the color bitplanes.
+func (i PlanarImage) GetBitplanesWithMask() []Bitplane {
+	if i.mask == nil {
+		return i.planes
+	}
+	return append([]Bitplane{*i.mask}, i.planes...)
+}
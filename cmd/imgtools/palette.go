@@ -0,0 +1,123 @@
+package imgtools
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math/bits"
+)
+
+// PaletteOptions control how the palette of an input image is built and fitted to a whole number of bitplanes. By
+// default, non-paletted images get an exact palette in first-seen order, and the palette is padded up to the next
+// power of two.
+type PaletteOptions struct {
+	// Index order of exact palettes built for non-paletted images.
+	Order PaletteOrder
+	// If not nil, images are remapped onto this palette, which must contain every color they use.
+	ReferencePalette color.Palette
+	// If not QuantizeNone, non-paletted images with more colors than the target size are quantized down to it.
+	Quantizer QuantizeMethod
+	Dither    DitherMethod
+	// If nonzero, the palette is padded to exactly this many colors.
+	FixedPaletteSize int
+	// If nonzero, the palette is padded to 1 << FixedNumBitplanes colors. Takes precedence over FixedPaletteSize.
+	FixedNumBitplanes int
+}
+
+func numBitplanesForColors(numColors int) int {
+	if numColors <= 2 {
+		return 1
+	}
+	return bits.Len(uint(numColors - 1))
+}
+
+func (o PaletteOptions) targetSize(numColors int) (int, error) {
+	switch {
+	case o.FixedNumBitplanes != 0:
+		if o.FixedNumBitplanes < 1 || o.FixedNumBitplanes > 8 {
+			return 0, fmt.Errorf("invalid fixed bitplane count %d (must be 1 to 8)", o.FixedNumBitplanes)
+		}
+		return 1 << o.FixedNumBitplanes, nil
+	case o.FixedPaletteSize != 0:
+		if o.FixedPaletteSize < 2 || o.FixedPaletteSize > 256 {
+			return 0, fmt.Errorf("invalid fixed palette size %d (must be 2 to 256)", o.FixedPaletteSize)
+		}
+		return o.FixedPaletteSize, nil
+	}
+	return 1 << numBitplanesForColors(numColors), nil
+}
+
+// defaultQuantizedColors is the target palette size for quantization when no fixed size is requested.
+const defaultQuantizedColors = 16
+
+func (o PaletteOptions) quantizedSize() (int, error) {
+	if o.FixedNumBitplanes == 0 && o.FixedPaletteSize == 0 {
+		return defaultQuantizedColors, nil
+	}
+	return o.targetSize(0)
+}
+
+// convertToPaletted builds a palette for a non-paletted image (or remaps onto the reference palette), exactly if
+// possible and by quantizing otherwise.
+func convertToPaletted(im image.Image, opts PaletteOptions) (*image.Paletted, error) {
+	if opts.Quantizer == QuantizeNone || opts.ReferencePalette != nil {
+		return ConvertToExactPalette(im, opts.Order, opts.ReferencePalette)
+	}
+	numColors, err := opts.quantizedSize()
+	if err != nil {
+		return nil, err
+	}
+	exact, err := ConvertToExactPalette(im, opts.Order, nil)
+	if err == nil && len(exact.Palette) <= numColors {
+		return exact, nil
+	}
+	quantized, err := Quantize(im, numColors, opts.Quantizer, opts.Dither)
+	if err != nil {
+		return nil, err
+	}
+	// Re-index so that the requested palette order also applies to quantized palettes.
+	return ConvertToExactPalette(quantized, opts.Order, nil)
+}
+
+// PadPalette pads pal with black entries up to the size selected by opts. The original entries keep their indices.
+func PadPalette(pal color.Palette, opts PaletteOptions) (color.Palette, error) {
+	size, err := opts.targetSize(len(pal))
+	if err != nil {
+		return nil, err
+	}
+	if len(pal) > size {
+		return nil, fmt.Errorf("palette has %d colors, which does not fit in the requested size of %d", len(pal), size)
+	}
+	result := make(color.Palette, size)
+	copy(result, pal)
+	for i := len(pal); i < size; i++ {
+		result[i] = color.RGBA{0, 0, 0, 0xFF}
+	}
+	return result, nil
+}
+
+// PadImagePalette returns a paletted image sharing the pixels of im, with its palette padded as per PadPalette.
+func PadImagePalette(im image.PalettedImage, opts PaletteOptions) (*image.Paletted, error) {
+	pal, ok := im.ColorModel().(color.Palette)
+	if !ok {
+		return nil, fmt.Errorf("image is not paletted")
+	}
+	padded, err := PadPalette(pal, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if p, ok := im.(*image.Paletted); ok {
+		result := *p
+		result.Palette = padded
+		return &result, nil
+	}
+	bounds := im.Bounds()
+	result := image.NewPaletted(bounds, padded)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			result.SetColorIndex(x, y, im.ColorIndexAt(x, y))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,226 @@
+package imgtools
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strings"
+)
+
+// Palette index permutation search. Which index each color gets decides the bit patterns in every bitplane, and so
+// how many zero crumbs are left after delta encoding.
+
+// PaletteCostFunc scores a candidate planar image; lower is better. It may modify the image.
+type PaletteCostFunc func(pi *PlanarImage) (uint64, error)
+
+type PaletteOptimizeOptions struct {
+	// Index of the color that must end up at index 0, or -1 to pick the most common color.
+	BackgroundIndex int
+	// Scoring function; if nil, NonZeroCrumbCost is used.
+	Cost PaletteCostFunc
+}
+
+const (
+	// palettes up to this size are searched exhaustively, larger ones by hill climbing
+	maxExhaustivePaletteColors = 4
+	maxHillClimbPasses         = 16
+	// bounds the number of candidates hill climbing scores, since a codec based cost compresses the whole image for
+	// each of them
+	maxHillClimbEvaluations = 2048
+)
+
+// NonZeroCrumbCost counts the crumbs left nonzero after delta encoding every bitplane.
+func NonZeroCrumbCost(pi *PlanarImage) (uint64, error) {
+	var count uint64
+	for _, bp := range pi.planes {
+		bp.DeltaEncode()
+		crp := BitplaneToCrumbPlane(&bp)
+		for _, row := range crp.crumbs {
+			for _, c := range row {
+				if c != 0 {
+					count++
+				}
+			}
+		}
+	}
+	return count, nil
+}
+
+type palettePermuter struct {
+	src     image.PalettedImage
+	palette color.Palette
+	cost    PaletteCostFunc
+}
+
+// apply builds the image where the color formerly at index i is moved to index perm[i].
+func (p *palettePermuter) apply(perm []int) *image.Paletted {
+	pal := make(color.Palette, len(p.palette))
+	for i, c := range p.palette {
+		pal[perm[i]] = c
+	}
+	bounds := p.src.Bounds()
+	result := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), pal)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			result.SetColorIndex(x-bounds.Min.X, y-bounds.Min.Y, uint8(perm[p.src.ColorIndexAt(x, y)]))
+		}
+	}
+	return result
+}
+
+func (p *palettePermuter) evaluate(perm []int) (uint64, error) {
+	pi, err := NewPlanarImage(p.apply(perm))
+	if err != nil {
+		return 0, err
+	}
+	return p.cost(pi)
+}
+
+func colorCounts(im image.PalettedImage, numColors int) []uint64 {
+	counts := make([]uint64, numColors)
+	bounds := im.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			counts[im.ColorIndexAt(x, y)]++
+		}
+	}
+	return counts
+}
+
+func mostCommonIndex(counts []uint64) int {
+	best := 0
+	for i, n := range counts {
+		if n > counts[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// permuteFrom calls fn for every permutation of perm[start:], restoring perm afterwards.
+func permuteFrom(perm []int, start int, fn func() error) error {
+	if start >= len(perm)-1 {
+		return fn()
+	}
+	for i := start; i < len(perm); i++ {
+		perm[start], perm[i] = perm[i], perm[start]
+		if err := permuteFrom(perm, start+1, fn); err != nil {
+			return err
+		}
+		perm[start], perm[i] = perm[i], perm[start]
+	}
+	return nil
+}
+
+// OptimizePaletteOrder searches for the palette index assignment that minimizes the cost of the image, keeping the
+// background color at index 0. Palettes of more than maxExhaustivePaletteColors colors are searched by swapping pairs
+// of indices, which scores at most maxHillClimbEvaluations candidates, so the result may not be the best order. It
+// returns the image remapped onto the reordered palette.
+func OptimizePaletteOrder(im image.PalettedImage, opts PaletteOptimizeOptions) (*image.Paletted, error) {
+	pal, ok := im.ColorModel().(color.Palette)
+	if !ok {
+		return nil, fmt.Errorf("image is not paletted")
+	}
+	if len(pal) > 256 {
+		return nil, fmt.Errorf("palette has %d colors (max 256)", len(pal))
+	}
+	p := palettePermuter{src: im, palette: pal, cost: opts.Cost}
+	if p.cost == nil {
+		p.cost = NonZeroCrumbCost
+	}
+
+	counts := colorCounts(im, len(pal))
+	bg := opts.BackgroundIndex
+	if bg < 0 {
+		bg = mostCommonIndex(counts)
+	}
+	if bg >= len(pal) {
+		return nil, fmt.Errorf("background index %d is outside the %d-color palette", bg, len(pal))
+	}
+
+	// perm[i] is the new index of the color at old index i.
+	perm := make([]int, len(pal))
+	for i := range perm {
+		perm[i] = i
+	}
+	perm[bg], perm[0] = 0, bg
+
+	best := append([]int(nil), perm...)
+	bestCost, err := p.evaluate(perm)
+	if err != nil {
+		return nil, err
+	}
+
+	// The background color is pinned at index 0 by keeping new index 0 out of the search; inv maps new indices back
+	// to old ones so only the other slots are shuffled.
+	inv := make([]int, len(perm))
+	for old, idx := range perm {
+		inv[idx] = old
+	}
+	toPerm := func() []int {
+		for idx, old := range inv {
+			perm[old] = idx
+		}
+		return perm
+	}
+
+	if len(pal) <= maxExhaustivePaletteColors {
+		err = permuteFrom(inv, 1, func() error {
+			cost, err := p.evaluate(toPerm())
+			if err != nil {
+				return err
+			}
+			if cost < bestCost {
+				bestCost = cost
+				copy(best, perm)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return p.apply(best), nil
+	}
+
+	// Swapping two colors the image doesn't use changes nothing, so every candidate moves at least one used color.
+	evaluations := 0
+	for range maxHillClimbPasses {
+		improved := false
+		for i := 1; i < len(inv) && evaluations < maxHillClimbEvaluations; i++ {
+			for j := i + 1; j < len(inv) && evaluations < maxHillClimbEvaluations; j++ {
+				if counts[inv[i]] == 0 && counts[inv[j]] == 0 {
+					continue
+				}
+				evaluations++
+				inv[i], inv[j] = inv[j], inv[i]
+				cost, err := p.evaluate(toPerm())
+				if err != nil {
+					return nil, err
+				}
+				if cost < bestCost {
+					bestCost = cost
+					copy(best, perm)
+					improved = true
+				} else {
+					inv[i], inv[j] = inv[j], inv[i]
+				}
+			}
+		}
+		if !improved || evaluations >= maxHillClimbEvaluations {
+			break
+		}
+	}
+	return p.apply(best), nil
+}
+
+// SavePaletteFile writes a palette as a JASC-PAL file.
+func SavePaletteFile(filename string, pal color.Palette) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "JASC-PAL\r\n0100\r\n%d\r\n", len(pal))
+	for _, c := range pal {
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(&sb, "%d %d %d\r\n", r>>8, g>>8, b>>8)
+	}
+	return os.WriteFile(filename, []byte(sb.String()), 0644)
+}
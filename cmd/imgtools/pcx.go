@@ -0,0 +1,204 @@
+package imgtools
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// ZSoft PCX support for indexed images: monochrome, CGA 2bpp, EGA/VGA 16-color (either packed 4bpp or 4 planes of
+// 1bpp, as well as 2 and 3-plane variants) and VGA 256-color.
+
+const (
+	pcxHeaderLen        = 128
+	pcxManufacturer     = 0x0A
+	pcxVGAPaletteMarker = 0x0C
+	pcxMaxDimension     = 1 << 15
+)
+
+var (
+	ErrPCXInvalid     = errors.New("invalid PCX data")
+	ErrPCXUnsupported = errors.New("unsupported PCX variant")
+)
+
+func init() {
+	image.RegisterFormat("pcx", "\x0A", DecodePCX, DecodePCXConfig)
+}
+
+type pcxHeader struct {
+	Manufacturer uint8
+	Version      uint8
+	Encoding     uint8
+	BitsPerPixel uint8
+	XMin, YMin   uint16
+	XMax, YMax   uint16
+	HDpi, VDpi   uint16
+	EGAPalette   [48]byte
+	Reserved     uint8
+	NumPlanes    uint8
+	BytesPerLine uint16
+	PaletteInfo  uint16
+	HScreenSize  uint16
+	VScreenSize  uint16
+	Filler       [54]byte
+}
+
+func readPCXHeader(r io.Reader) (*pcxHeader, error) {
+	var hdr pcxHeader
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPCXInvalid, err)
+	}
+	if hdr.Manufacturer != pcxManufacturer || hdr.Encoding > 1 {
+		return nil, fmt.Errorf("%w: not a PCX file", ErrPCXInvalid)
+	}
+	if hdr.XMax < hdr.XMin || hdr.YMax < hdr.YMin {
+		return nil, fmt.Errorf("%w: negative image size", ErrPCXInvalid)
+	}
+	width, height := hdr.width(), hdr.height()
+	if width > pcxMaxDimension || height > pcxMaxDimension {
+		return nil, fmt.Errorf("%w: image size %dx%d", ErrPCXInvalid, width, height)
+	}
+	if width*height > maxDecodedPixels {
+		return nil, fmt.Errorf("%w: image size %dx%d is over the limit of %d pixels", ErrPCXUnsupported, width, height, maxDecodedPixels)
+	}
+
+	switch {
+	case hdr.NumPlanes == 1 && (hdr.BitsPerPixel == 1 || hdr.BitsPerPixel == 2 || hdr.BitsPerPixel == 4 || hdr.BitsPerPixel == 8):
+	case hdr.BitsPerPixel == 1 && hdr.NumPlanes >= 2 && hdr.NumPlanes <= 4:
+	default:
+		return nil, fmt.Errorf("%w: %d planes of %d bits per pixel", ErrPCXUnsupported, hdr.NumPlanes, hdr.BitsPerPixel)
+	}
+	// lines are padded to an even length, and some writers pad them to 32 bits
+	minBytesPerLine := (width*int(hdr.BitsPerPixel) + 7) / 8
+	if int(hdr.BytesPerLine) < minBytesPerLine || int(hdr.BytesPerLine) > (minBytesPerLine+3)/4*4 {
+		return nil, fmt.Errorf("%w: %d bytes per line doesn't match a width of %d pixels", ErrPCXInvalid, hdr.BytesPerLine, width)
+	}
+	return &hdr, nil
+}
+
+func (hdr *pcxHeader) width() int {
+	return int(hdr.XMax) - int(hdr.XMin) + 1
+}
+
+func (hdr *pcxHeader) height() int {
+	return int(hdr.YMax) - int(hdr.YMin) + 1
+}
+
+func (hdr *pcxHeader) bitsPerIndex() int {
+	return int(hdr.BitsPerPixel) * int(hdr.NumPlanes)
+}
+
+// headerPalette returns the palette stored in the header, which is only meaningful for images with up to 16 colors.
+func (hdr *pcxHeader) headerPalette() color.Palette {
+	numColors := 1 << hdr.bitsPerIndex()
+	if hdr.bitsPerIndex() == 1 {
+		return color.Palette{color.RGBA{0, 0, 0, 0xFF}, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}}
+	}
+	result := make(color.Palette, numColors)
+	for i := range result {
+		p := hdr.EGAPalette[i*3:]
+		result[i] = color.RGBA{p[0], p[1], p[2], 0xFF}
+	}
+	return result
+}
+
+func DecodePCXConfig(r io.Reader) (image.Config, error) {
+	hdr, err := readPCXHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	var pal color.Palette
+	if hdr.bitsPerIndex() == 8 {
+		pal = GrayscalePalette(256)
+	} else {
+		pal = hdr.headerPalette()
+	}
+	return image.Config{
+		ColorModel: pal,
+		Width:      hdr.width(),
+		Height:     hdr.height(),
+	}, nil
+}
+
+func DecodePCX(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	hdr, err := readPCXHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	width, height := hdr.width(), hdr.height()
+	lineLen := int(hdr.BytesPerLine) * int(hdr.NumPlanes)
+
+	// Decode all scanlines up front, since the 256-color palette comes after the pixel data.
+	pixelData := make([]byte, lineLen*height)
+	if hdr.Encoding == 1 {
+		err = unpackPCXRLE(br, pixelData)
+	} else {
+		_, err = io.ReadFull(br, pixelData)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: pixel data ended early", ErrPCXInvalid)
+	}
+
+	var pal color.Palette
+	if hdr.bitsPerIndex() == 8 {
+		rest, _ := io.ReadAll(br)
+		if len(rest) < 769 || rest[len(rest)-769] != pcxVGAPaletteMarker {
+			return nil, fmt.Errorf("%w: 256-color palette is missing", ErrPCXInvalid)
+		}
+		idx := len(rest) - 769
+		pal = make(color.Palette, 256)
+		for i := range pal {
+			p := rest[idx+1+i*3:]
+			pal[i] = color.RGBA{p[0], p[1], p[2], 0xFF}
+		}
+	} else {
+		pal = hdr.headerPalette()
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, width, height), pal)
+	bpp := int(hdr.BitsPerPixel)
+	pixelsPerByte := 8 / bpp
+	mask := uint8(1<<bpp) - 1
+	for y := range height {
+		line := pixelData[y*lineLen : (y+1)*lineLen]
+		for x := range width {
+			var idx uint8
+			for p := range int(hdr.NumPlanes) {
+				b := line[p*int(hdr.BytesPerLine)+x/pixelsPerByte]
+				shift := (pixelsPerByte - 1 - x%pixelsPerByte) * bpp
+				idx |= ((b >> shift) & mask) << (p * bpp)
+			}
+			img.SetColorIndex(x, y, idx)
+		}
+	}
+	return img, nil
+}
+
+func unpackPCXRLE(r io.ByteReader, dest []byte) error {
+	for pos := 0; pos < len(dest); {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b&0xC0 != 0xC0 {
+			dest[pos] = b
+			pos++
+			continue
+		}
+		count := int(b & 0x3F)
+		v, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < count && pos < len(dest); i++ {
+			dest[pos] = v
+			pos++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package imgtools
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"slices"
+	"strings"
+)
+
+type QuantizeMethod int
+
+const (
+	QuantizeNone QuantizeMethod = iota
+	QuantizeMedianCut
+	// k-means refinement of a median-cut palette
+	QuantizeKMeans
+)
+
+type DitherMethod int
+
+const (
+	DitherNone DitherMethod = iota
+	// 8x8 Bayer matrix
+	DitherOrdered
+	DitherFloydSteinberg
+)
+
+var quantizeMethodNames = map[QuantizeMethod]string{
+	QuantizeNone:      "none",
+	QuantizeMedianCut: "mediancut",
+	QuantizeKMeans:    "kmeans",
+}
+
+var ditherMethodNames = map[DitherMethod]string{
+	DitherNone:           "none",
+	DitherOrdered:        "ordered",
+	DitherFloydSteinberg: "floydsteinberg",
+}
+
+// DitherMethods lists every available dithering method, in order of declaration.
+var DitherMethods = []DitherMethod{DitherNone, DitherOrdered, DitherFloydSteinberg}
+
+const kMeansIterations = 16
+
+func ParseQuantizeMethod(name string) (QuantizeMethod, error) {
+	name = strings.ToLower(name)
+	for m, n := range quantizeMethodNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown quantization method '%s'", name)
+}
+
+func (m QuantizeMethod) String() string {
+	if n, ok := quantizeMethodNames[m]; ok {
+		return n
+	}
+	return fmt.Sprintf("QuantizeMethod(%d)", int(m))
+}
+
+func ParseDitherMethod(name string) (DitherMethod, error) {
+	name = strings.ToLower(name)
+	for m, n := range ditherMethodNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dithering method '%s'", name)
+}
+
+func (m DitherMethod) String() string {
+	if n, ok := ditherMethodNames[m]; ok {
+		return n
+	}
+	return fmt.Sprintf("DitherMethod(%d)", int(m))
+}
+
+type histEntry struct {
+	rgb   [3]float64
+	count uint64
+}
+
+// colorHistogram collects the distinct opaque RGB colors of an image; alpha is ignored.
+func colorHistogram(im image.Image) []histEntry {
+	bounds := im.Bounds()
+	counts := make(map[[3]uint8]uint64)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := im.At(x, y).RGBA()
+			counts[[3]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)}]++
+		}
+	}
+	result := make([]histEntry, 0, len(counts))
+	for c, n := range counts {
+		result = append(result, histEntry{rgb: [3]float64{float64(c[0]), float64(c[1]), float64(c[2])}, count: n})
+	}
+	// Map iteration order is random; sorting keeps the output reproducible.
+	slices.SortFunc(result, func(a, b histEntry) int {
+		return slices.Compare(a.rgb[:], b.rgb[:])
+	})
+	return result
+}
+
+type colorBox struct {
+	entries []histEntry
+}
+
+func (b colorBox) widestChannel() (channel int, extent float64) {
+	for ch := range 3 {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, e := range b.entries {
+			lo = min(lo, e.rgb[ch])
+			hi = max(hi, e.rgb[ch])
+		}
+		if hi-lo > extent {
+			channel, extent = ch, hi-lo
+		}
+	}
+	return
+}
+
+func (b colorBox) mean() [3]float64 {
+	var sum [3]float64
+	var total float64
+	for _, e := range b.entries {
+		for ch := range 3 {
+			sum[ch] += e.rgb[ch] * float64(e.count)
+		}
+		total += float64(e.count)
+	}
+	for ch := range 3 {
+		sum[ch] /= total
+	}
+	return sum
+}
+
+func medianCut(hist []histEntry, numColors int) [][3]float64 {
+	boxes := []colorBox{{entries: hist}}
+	for len(boxes) < numColors {
+		// Split the box with the widest channel extent, weighted by the number of pixels it holds.
+		best, bestScore, bestChannel := -1, 0.0, 0
+		for i, b := range boxes {
+			if len(b.entries) < 2 {
+				continue
+			}
+			ch, extent := b.widestChannel()
+			var pixels uint64
+			for _, e := range b.entries {
+				pixels += e.count
+			}
+			if score := extent * float64(pixels); score > bestScore {
+				best, bestScore, bestChannel = i, score, ch
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		entries := boxes[best].entries
+		slices.SortStableFunc(entries, func(a, b histEntry) int {
+			return int(a.rgb[bestChannel] - b.rgb[bestChannel])
+		})
+		var total, acc uint64
+		for _, e := range entries {
+			total += e.count
+		}
+		split := 1
+		for i, e := range entries[:len(entries)-1] {
+			acc += e.count
+			if acc*2 >= total {
+				split = i + 1
+				break
+			}
+		}
+		boxes[best] = colorBox{entries: entries[:split]}
+		boxes = append(boxes, colorBox{entries: entries[split:]})
+	}
+
+	result := make([][3]float64, len(boxes))
+	for i, b := range boxes {
+		result[i] = b.mean()
+	}
+	return result
+}
+
+func nearestCentroid(centroids [][3]float64, c [3]float64) int {
+	best, bestDist := 0, math.Inf(1)
+	for i, ct := range centroids {
+		var dist float64
+		for ch := range 3 {
+			d := ct[ch] - c[ch]
+			dist += d * d
+		}
+		if dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+func kMeansRefine(hist []histEntry, centroids [][3]float64) [][3]float64 {
+	for range kMeansIterations {
+		sums := make([][3]float64, len(centroids))
+		totals := make([]float64, len(centroids))
+		for _, e := range hist {
+			i := nearestCentroid(centroids, e.rgb)
+			for ch := range 3 {
+				sums[i][ch] += e.rgb[ch] * float64(e.count)
+			}
+			totals[i] += float64(e.count)
+		}
+		moved := false
+		for i := range centroids {
+			if totals[i] == 0 {
+				continue
+			}
+			for ch := range 3 {
+				v := sums[i][ch] / totals[i]
+				if math.Abs(v-centroids[i][ch]) > 0.25 {
+					moved = true
+				}
+				centroids[i][ch] = v
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+	return centroids
+}
+
+// BuildQuantizedPalette picks up to numColors colors representing the colors of im.
+func BuildQuantizedPalette(im image.Image, numColors int, method QuantizeMethod) (color.Palette, error) {
+	if numColors < 2 || numColors > 256 {
+		return nil, fmt.Errorf("cannot quantize to %d colors (must be 2 to 256)", numColors)
+	}
+	hist := colorHistogram(im)
+	var centroids [][3]float64
+	switch method {
+	case QuantizeMedianCut:
+		centroids = medianCut(hist, numColors)
+	case QuantizeKMeans:
+		centroids = kMeansRefine(hist, medianCut(hist, numColors))
+	default:
+		return nil, fmt.Errorf("unknown quantization method %s", method)
+	}
+
+	pal := make(color.Palette, 0, len(centroids))
+	seen := make(map[color.RGBA]bool)
+	for _, ct := range centroids {
+		c := color.RGBA{uint8(math.Round(ct[0])), uint8(math.Round(ct[1])), uint8(math.Round(ct[2])), 0xFF}
+		if !seen[c] {
+			seen[c] = true
+			pal = append(pal, c)
+		}
+	}
+	return pal, nil
+}
+
+var bayer8x8 = [8][8]uint8{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+func ditherOrdered(dst *image.Paletted, src image.Image) {
+	bounds := dst.Bounds()
+	srcMin := src.Bounds().Min
+	// Spread the threshold over roughly the distance between neighboring palette levels on each axis.
+	spread := 255 / math.Cbrt(float64(len(dst.Palette)))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			offs := (float64(bayer8x8[y&7][x&7])+0.5)/64 - 0.5
+			r, g, b, _ := src.At(srcMin.X+x-bounds.Min.X, srcMin.Y+y-bounds.Min.Y).RGBA()
+			c := color.RGBA{
+				uint8(max(0, min(255, float64(r>>8)+offs*spread))),
+				uint8(max(0, min(255, float64(g>>8)+offs*spread))),
+				uint8(max(0, min(255, float64(b>>8)+offs*spread))),
+				0xFF,
+			}
+			dst.SetColorIndex(x, y, uint8(dst.Palette.Index(c)))
+		}
+	}
+}
+
+// Quantize reduces im to at most numColors colors, dithering as per dither.
+func Quantize(im image.Image, numColors int, method QuantizeMethod, dither DitherMethod) (*image.Paletted, error) {
+	pal, err := BuildQuantizedPalette(im, numColors, method)
+	if err != nil {
+		return nil, err
+	}
+	bounds := im.Bounds()
+	result := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), pal)
+	switch dither {
+	case DitherNone:
+		draw.Draw(result, result.Bounds(), im, bounds.Min, draw.Src)
+	case DitherOrdered:
+		ditherOrdered(result, im)
+	case DitherFloydSteinberg:
+		draw.FloydSteinberg.Draw(result, result.Bounds(), im, bounds.Min)
+	default:
+		return nil, fmt.Errorf("unknown dithering method %s", dither)
+	}
+	return result, nil
+}
@@ -0,0 +1,158 @@
+package imgtools
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"strings"
+)
+
+// PlaneInterleave describes how the bitplanes of a raw planar image are laid out in memory.
+type PlaneInterleave int
+
+const (
+	// every plane stored whole, one after the other
+	InterleaveNone PlaneInterleave = iota
+	// one row of each plane in turn, as in ILBM BODY data or Amiga interleaved bitmaps
+	InterleaveLine
+	// one 16-bit big-endian word of each plane in turn, as in Atari ST screen memory
+	InterleaveWord
+)
+
+var planeInterleaveNames = map[PlaneInterleave]string{
+	InterleaveNone: "none",
+	InterleaveLine: "line",
+	InterleaveWord: "word",
+}
+
+func ParsePlaneInterleave(name string) (PlaneInterleave, error) {
+	name = strings.ToLower(name)
+	for m, n := range planeInterleaveNames {
+		if n == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown plane interleave mode '%s'", name)
+}
+
+func (m PlaneInterleave) String() string {
+	if n, ok := planeInterleaveNames[m]; ok {
+		return n
+	}
+	return fmt.Sprintf("PlaneInterleave(%d)", int(m))
+}
+
+// rowBytes returns the size of a single plane's row in bytes. Word-interleaved rows are padded to 16 pixels.
+func (m PlaneInterleave) rowBytes(width uint64) uint64 {
+	if m == InterleaveWord {
+		return (width + 15) / 16 * 2
+	}
+	return (width + 7) / 8
+}
+
+// RawPlanarSize returns the number of bytes DecodeRawPlanar expects for the given parameters. The result wraps around
+// for sizes far beyond what DecodeRawPlanar accepts.
+func RawPlanarSize(width, height uint64, numPlanes int, mode PlaneInterleave) uint64 {
+	return mode.rowBytes(width) * height * uint64(numPlanes)
+}
+
+// DecodeRawPlanar reads headerless planar bitmap data with an explicit size, plane count and interleave mode.
+// Any data past the end of the bitmap is ignored. If palette is nil, a grayscale palette is generated.
+func DecodeRawPlanar(data []byte, width, height uint64, numPlanes int, mode PlaneInterleave, palette color.Palette) (*PlanarImage, error) {
+	if _, ok := planeInterleaveNames[mode]; !ok {
+		return nil, fmt.Errorf("unknown plane interleave mode %s", mode)
+	}
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("invalid raw planar image size %dx%d", width, height)
+	}
+	if width > maxDecodedPixels || height > maxDecodedPixels || width*height > maxDecodedPixels {
+		return nil, fmt.Errorf("raw planar image size %dx%d is over the limit of %d pixels", width, height, maxDecodedPixels)
+	}
+	if numPlanes <= 0 || numPlanes > 16 {
+		return nil, fmt.Errorf("invalid bitplane count %d (must be 1 to 16)", numPlanes)
+	}
+	expectedSize := RawPlanarSize(width, height, numPlanes, mode)
+	if uint64(len(data)) < expectedSize {
+		return nil, fmt.Errorf("raw planar data has %d bytes, but a %dx%d image with %d planes needs %d", len(data), width, height, numPlanes, expectedSize)
+	}
+
+	planes := make([]Bitplane, numPlanes)
+	for p := range planes {
+		planes[p] = *NewBitplane(width, height)
+	}
+	rowBytes := mode.rowBytes(width)
+	bpBytes := planes[0].GetWidthBpBytes()
+	lastByteMask := ^uint8(0) << ((8 - width%8) % 8)
+
+	for p := range planes {
+		for y := range height {
+			dest := planes[p].data[y]
+			switch mode {
+			case InterleaveNone:
+				offs := (uint64(p)*height + y) * rowBytes
+				copy(dest, data[offs:offs+bpBytes])
+			case InterleaveLine:
+				offs := (y*uint64(numPlanes) + uint64(p)) * rowBytes
+				copy(dest, data[offs:offs+bpBytes])
+			case InterleaveWord:
+				rowOffs := y * rowBytes * uint64(numPlanes)
+				for i := range bpBytes {
+					offs := rowOffs + (i/2*uint64(numPlanes)+uint64(p))*2 + i%2
+					dest[i] = data[offs]
+				}
+			}
+			dest[len(dest)-1] &= lastByteMask
+		}
+	}
+	return NewPlanarImageFromBitplanes(planes, palette)
+}
+
+// EncodeRawPlanar is the reverse of DecodeRawPlanar: it lays out bitplanes of the same size as headerless planar
+// data, padding rows with zeros as the interleave mode requires.
+func EncodeRawPlanar(planes []Bitplane, mode PlaneInterleave) ([]byte, error) {
+	if _, ok := planeInterleaveNames[mode]; !ok {
+		return nil, fmt.Errorf("unknown plane interleave mode %s", mode)
+	}
+	if len(planes) == 0 || len(planes) > 16 {
+		return nil, fmt.Errorf("invalid bitplane count %d (must be 1 to 16)", len(planes))
+	}
+	width, height := planes[0].width, planes[0].height
+	for p, bp := range planes {
+		if bp.width != width || bp.height != height {
+			return nil, fmt.Errorf("bitplane %d has size %dx%d, expected %dx%d", p, bp.width, bp.height, width, height)
+		}
+	}
+
+	numPlanes := uint64(len(planes))
+	rowBytes := mode.rowBytes(width)
+	result := make([]byte, RawPlanarSize(width, height, len(planes), mode))
+	for p := range planes {
+		for y := range height {
+			src := planes[p].data[y]
+			switch mode {
+			case InterleaveNone:
+				copy(result[(uint64(p)*height+y)*rowBytes:], src)
+			case InterleaveLine:
+				copy(result[(y*numPlanes+uint64(p))*rowBytes:], src)
+			case InterleaveWord:
+				rowOffs := y * rowBytes * numPlanes
+				for i := range uint64(len(src)) {
+					result[rowOffs+(i/2*numPlanes+uint64(p))*2+i%2] = src[i]
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+func LoadRawPlanar(filename string, width, height uint64, numPlanes int, mode PlaneInterleave) (*PlanarImage, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pi, err := DecodeRawPlanar(data, width, height, numPlanes, mode, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode raw planar file '%s': %w", filename, err)
+	}
+	return pi, nil
+}
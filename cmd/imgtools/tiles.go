@@ -0,0 +1,232 @@
+package imgtools
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"strings"
+)
+
+// TileFormat identifies one of the raw 8x8 planar tile layouts used by game consoles.
+type TileFormat int
+
+const (
+	// 2bpp, planes 0 and 1 interleaved per row (Game Boy, SNES 2bpp)
+	TileFormatGB TileFormat = iota
+	// 2bpp, all 8 rows of plane 0 followed by all 8 rows of plane 1 (NES)
+	TileFormatNES
+	// 4bpp, planes 0/1 row-interleaved followed by planes 2/3 row-interleaved (SNES 4bpp)
+	TileFormatSNES4
+	// 4bpp, planes 0 to 3 interleaved per row (Master System, Game Gear)
+	TileFormatSMS
+	// 4bpp packed, two pixels per byte with the leftmost pixel in the high nibble (Mega Drive/Genesis)
+	TileFormatGenesis
+)
+
+const tileSizePx = 8
+
+var tileFormatNames = map[TileFormat]string{
+	TileFormatGB:      "gb",
+	TileFormatNES:     "nes",
+	TileFormatSNES4:   "snes4",
+	TileFormatSMS:     "sms",
+	TileFormatGenesis: "genesis",
+}
+
+func ParseTileFormat(name string) (TileFormat, error) {
+	name = strings.ToLower(name)
+	for f, n := range tileFormatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	if name == "snes" || name == "snes2" {
+		return TileFormatGB, nil
+	}
+	return 0, fmt.Errorf("unknown tile format '%s'", name)
+}
+
+func (f TileFormat) String() string {
+	if n, ok := tileFormatNames[f]; ok {
+		return n
+	}
+	return fmt.Sprintf("TileFormat(%d)", int(f))
+}
+
+func (f TileFormat) BitsPerPixel() int {
+	switch f {
+	case TileFormatGB, TileFormatNES:
+		return 2
+	default:
+		return 4
+	}
+}
+
+func (f TileFormat) BytesPerTile() int {
+	return f.BitsPerPixel() * tileSizePx
+}
+
+// tileRows holds one 8x8 tile as one byte per row per plane.
+type tileRows [][tileSizePx]byte
+
+func (f TileFormat) serializeTile(t tileRows, dest []byte) {
+	switch f {
+	case TileFormatGB:
+		for y := range tileSizePx {
+			dest[y*2] = t[0][y]
+			dest[y*2+1] = t[1][y]
+		}
+	case TileFormatNES:
+		for y := range tileSizePx {
+			dest[y] = t[0][y]
+			dest[y+tileSizePx] = t[1][y]
+		}
+	case TileFormatSNES4:
+		for y := range tileSizePx {
+			dest[y*2] = t[0][y]
+			dest[y*2+1] = t[1][y]
+			dest[y*2+16] = t[2][y]
+			dest[y*2+17] = t[3][y]
+		}
+	case TileFormatSMS:
+		for y := range tileSizePx {
+			for p := range 4 {
+				dest[y*4+p] = t[p][y]
+			}
+		}
+	case TileFormatGenesis:
+		for y := range tileSizePx {
+			for x := range tileSizePx {
+				var idx byte
+				for p := range 4 {
+					idx |= ((t[p][y] >> (7 - x)) & 0x01) << p
+				}
+				dest[y*4+x/2] |= idx << (4 * (1 - x%2))
+			}
+		}
+	}
+}
+
+func (f TileFormat) deserializeTile(src []byte) tileRows {
+	t := make(tileRows, f.BitsPerPixel())
+	switch f {
+	case TileFormatGB:
+		for y := range tileSizePx {
+			t[0][y] = src[y*2]
+			t[1][y] = src[y*2+1]
+		}
+	case TileFormatNES:
+		for y := range tileSizePx {
+			t[0][y] = src[y]
+			t[1][y] = src[y+tileSizePx]
+		}
+	case TileFormatSNES4:
+		for y := range tileSizePx {
+			t[0][y] = src[y*2]
+			t[1][y] = src[y*2+1]
+			t[2][y] = src[y*2+16]
+			t[3][y] = src[y*2+17]
+		}
+	case TileFormatSMS:
+		for y := range tileSizePx {
+			for p := range 4 {
+				t[p][y] = src[y*4+p]
+			}
+		}
+	case TileFormatGenesis:
+		for y := range tileSizePx {
+			for x := range tileSizePx {
+				idx := (src[y*4+x/2] >> (4 * (1 - x%2))) & 0x0F
+				for p := range 4 {
+					t[p][y] |= ((idx >> p) & 0x01) << (7 - x)
+				}
+			}
+		}
+	}
+	return t
+}
+
+// EncodeTiles converts a planar image into raw tile data, tiles ordered left to right, top to bottom.
+// Images whose size is not a multiple of 8 pixels are padded with color index 0.
+func EncodeTiles(pi *PlanarImage, format TileFormat) ([]byte, error) {
+	if _, ok := tileFormatNames[format]; !ok {
+		return nil, fmt.Errorf("unknown tile format %s", format)
+	}
+	if len(pi.planes) > format.BitsPerPixel() {
+		return nil, fmt.Errorf("image has %d bitplanes, but tile format %s only holds %d", len(pi.planes), format, format.BitsPerPixel())
+	}
+	widthTiles := int((pi.width + tileSizePx - 1) / tileSizePx)
+	heightTiles := int((pi.height + tileSizePx - 1) / tileSizePx)
+	result := make([]byte, widthTiles*heightTiles*format.BytesPerTile())
+
+	t := make(tileRows, format.BitsPerPixel())
+	for ty := range heightTiles {
+		for tx := range widthTiles {
+			for p := range t {
+				for y := range tileSizePx {
+					t[p][y] = 0
+					py := ty*tileSizePx + y
+					if p < len(pi.planes) && py < int(pi.height) {
+						t[p][y] = pi.planes[p].data[py][tx]
+					}
+				}
+			}
+			offs := (ty*widthTiles + tx) * format.BytesPerTile()
+			format.serializeTile(t, result[offs:offs+format.BytesPerTile()])
+		}
+	}
+	return result, nil
+}
+
+// DecodeTiles converts raw tile data into a planar image widthTiles tiles wide. If palette is nil, a grayscale
+// palette is generated.
+func DecodeTiles(data []byte, format TileFormat, widthTiles int, palette color.Palette) (*PlanarImage, error) {
+	if _, ok := tileFormatNames[format]; !ok {
+		return nil, fmt.Errorf("unknown tile format %s", format)
+	}
+	if widthTiles <= 0 {
+		return nil, fmt.Errorf("invalid width of %d tiles", widthTiles)
+	}
+	rowSize := widthTiles * format.BytesPerTile()
+	if len(data) == 0 || len(data)%rowSize != 0 {
+		return nil, fmt.Errorf("tile data length %d is not a multiple of a %d-tile row (%d bytes)", len(data), widthTiles, rowSize)
+	}
+	heightTiles := len(data) / rowSize
+
+	planes := make([]Bitplane, format.BitsPerPixel())
+	for p := range planes {
+		planes[p] = *NewBitplane(uint64(widthTiles*tileSizePx), uint64(heightTiles*tileSizePx))
+	}
+	for ty := range heightTiles {
+		for tx := range widthTiles {
+			offs := (ty*widthTiles + tx) * format.BytesPerTile()
+			t := format.deserializeTile(data[offs : offs+format.BytesPerTile()])
+			for p := range t {
+				for y := range tileSizePx {
+					planes[p].data[ty*tileSizePx+y][tx] = t[p][y]
+				}
+			}
+		}
+	}
+	return NewPlanarImageFromBitplanes(planes, palette)
+}
+
+func SaveTiles(filename string, pi *PlanarImage, format TileFormat) error {
+	data, err := EncodeTiles(pi, format)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+func LoadTiles(filename string, format TileFormat, widthTiles int) (*PlanarImage, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pi, err := DecodeTiles(data, format, widthTiles, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode tile file '%s': %w", filename, err)
+	}
+	return pi, nil
+}
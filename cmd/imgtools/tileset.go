@@ -0,0 +1,263 @@
+package imgtools
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"math/bits"
+)
+
+// MaxTilesetTiles is the number of distinct tiles a tilemap entry can refer to.
+const MaxTilesetTiles = 1 << 14
+
+// The tileset image has to fit in the 2040x510 pixels a compressed bitplane can describe, which is 255x63 tiles. That
+// is fewer tiles than MaxTilesetTiles, so it's what bounds the number of distinct tiles in practice.
+const (
+	MaxTilesetWidthTiles  = 255
+	MaxTilesetHeightTiles = 63
+
+	defaultTilesetWidthTiles = 16
+)
+
+// TilemapEntry places one tile of a tileset, optionally mirrored.
+type TilemapEntry struct {
+	Tile  int
+	HFlip bool
+	VFlip bool
+}
+
+// Word packs the entry into 16 bits: the tile index in bits 0-13, the horizontal flip in bit 14 and the vertical flip
+// in bit 15.
+func (e TilemapEntry) Word() uint16 {
+	w := uint16(e.Tile) & (MaxTilesetTiles - 1)
+	if e.HFlip {
+		w |= 1 << 14
+	}
+	if e.VFlip {
+		w |= 1 << 15
+	}
+	return w
+}
+
+func TilemapEntryFromWord(w uint16) TilemapEntry {
+	return TilemapEntry{
+		Tile:  int(w & (MaxTilesetTiles - 1)),
+		HFlip: w&(1<<14) != 0,
+		VFlip: w&(1<<15) != 0,
+	}
+}
+
+// Tilemap lays out the tiles of a tileset on a grid, left to right, top to bottom.
+type Tilemap struct {
+	WidthTiles, HeightTiles int
+	Entries                 []TilemapEntry
+}
+
+// Words returns the entries packed as per TilemapEntry.Word.
+func (tm *Tilemap) Words() []uint16 {
+	result := make([]uint16, len(tm.Entries))
+	for i, e := range tm.Entries {
+		result[i] = e.Word()
+	}
+	return result
+}
+
+// MarshalWords returns the entries packed as per TilemapEntry.Word, as big-endian 16-bit words.
+func (tm *Tilemap) MarshalWords() []byte {
+	var result []byte
+	for _, w := range tm.Words() {
+		result = binary.BigEndian.AppendUint16(result, w)
+	}
+	return result
+}
+
+func NewTilemapFromWords(widthTiles, heightTiles int, words []uint16) (*Tilemap, error) {
+	if len(words) != widthTiles*heightTiles {
+		return nil, fmt.Errorf("a %dx%d tilemap needs %d entries, got %d", widthTiles, heightTiles, widthTiles*heightTiles, len(words))
+	}
+	result := &Tilemap{WidthTiles: widthTiles, HeightTiles: heightTiles}
+	for _, w := range words {
+		result.Entries = append(result.Entries, TilemapEntryFromWord(w))
+	}
+	return result, nil
+}
+
+// UnmarshalTilemapWords is the reverse of MarshalWords.
+func UnmarshalTilemapWords(widthTiles, heightTiles int, data []byte) (*Tilemap, error) {
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("tilemap data has an odd length of %d bytes", len(data))
+	}
+	words := make([]uint16, len(data)/2)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(data[i*2:])
+	}
+	return NewTilemapFromWords(widthTiles, heightTiles, words)
+}
+
+type TilesetOptions struct {
+	// also match tiles against horizontally and/or vertically mirrored copies of known ones
+	Flips bool
+	// width of the tileset image, in tiles (default: 16, or as narrow as possible if the tiles don't fit in
+	// MaxTilesetHeightTiles rows of 16)
+	WidthTiles int
+}
+
+func (t tileRows) key() string {
+	var result []byte
+	for _, rows := range t {
+		result = append(result, rows[:]...)
+	}
+	return string(result)
+}
+
+func (t tileRows) flipped(hFlip, vFlip bool) tileRows {
+	result := make(tileRows, len(t))
+	for p, rows := range t {
+		for y, row := range rows {
+			if hFlip {
+				row = bits.Reverse8(row)
+			}
+			if vFlip {
+				result[p][tileSizePx-1-y] = row
+			} else {
+				result[p][y] = row
+			}
+		}
+	}
+	return result
+}
+
+func (pi *PlanarImage) getTile(tx, ty int) tileRows {
+	t := make(tileRows, len(pi.planes))
+	for p := range t {
+		for y := range tileSizePx {
+			if py := ty*tileSizePx + y; py < int(pi.height) {
+				t[p][y] = pi.planes[p].data[py][tx]
+			}
+		}
+	}
+	if pi.width%tileSizePx != 0 && tx == int(pi.width/tileSizePx) {
+		// clear whatever lies past the right edge of the image
+		mask := uint8(0xFF) << (tileSizePx - pi.width%tileSizePx)
+		for p := range t {
+			for y := range t[p] {
+				t[p][y] &= mask
+			}
+		}
+	}
+	return t
+}
+
+func (pi *PlanarImage) setTile(tx, ty int, t tileRows) {
+	for p := range t {
+		for y := range tileSizePx {
+			pi.planes[p].data[ty*tileSizePx+y][tx] = t[p][y]
+		}
+	}
+}
+
+// ExtractTileset cuts an image into 8x8 tiles, padding it with color index 0 up to a multiple of 8 pixels, and
+// returns the distinct tiles as a tileset image along with the tilemap that rebuilds the image from them. Tiles are
+// numbered in the order they first appear, left to right, then top to bottom in the tileset image; unused slots at
+// the end of its last row are left blank.
+func ExtractTileset(pi *PlanarImage, opts TilesetOptions) (tileset *PlanarImage, tilemap *Tilemap, err error) {
+	if opts.WidthTiles < 0 || opts.WidthTiles > MaxTilesetWidthTiles {
+		return nil, nil, fmt.Errorf("tileset width of %d tiles is out of range (1-%d)", opts.WidthTiles, MaxTilesetWidthTiles)
+	}
+	maxWidthTiles := MaxTilesetWidthTiles
+	if opts.WidthTiles != 0 {
+		maxWidthTiles = opts.WidthTiles
+	}
+	maxTiles := maxWidthTiles * MaxTilesetHeightTiles
+
+	widthTiles := int((pi.width + tileSizePx - 1) / tileSizePx)
+	heightTiles := int((pi.height + tileSizePx - 1) / tileSizePx)
+	tilemap = &Tilemap{WidthTiles: widthTiles, HeightTiles: heightTiles}
+
+	flips := []TilemapEntry{{}}
+	if opts.Flips {
+		flips = append(flips, TilemapEntry{HFlip: true}, TilemapEntry{VFlip: true}, TilemapEntry{HFlip: true, VFlip: true})
+	}
+	tileIndices := make(map[string]int)
+	var tiles []tileRows
+	for ty := range heightTiles {
+		for tx := range widthTiles {
+			t := pi.getTile(tx, ty)
+			entry := TilemapEntry{Tile: -1}
+			for _, flip := range flips {
+				// a tile that matches a flipped copy of a known tile is that tile, flipped back
+				if idx, ok := tileIndices[t.flipped(flip.HFlip, flip.VFlip).key()]; ok {
+					entry = TilemapEntry{Tile: idx, HFlip: flip.HFlip, VFlip: flip.VFlip}
+					break
+				}
+			}
+			if entry.Tile < 0 {
+				if len(tiles) == maxTiles {
+					return nil, nil, fmt.Errorf("image has more than %d distinct tiles, which don't fit in a %dx%d tileset image", maxTiles, maxWidthTiles*tileSizePx, MaxTilesetHeightTiles*tileSizePx)
+				}
+				entry.Tile = len(tiles)
+				tileIndices[t.key()] = len(tiles)
+				tiles = append(tiles, t)
+			}
+			tilemap.Entries = append(tilemap.Entries, entry)
+		}
+	}
+
+	tileset, err = newTilesetImage(tiles, len(pi.planes), opts.WidthTiles, pi.palette)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tileset, tilemap, nil
+}
+
+// newTilesetImage lays out tiles on a grid widthTiles wide (see TilesetOptions.WidthTiles for the default), or fewer if
+// there are fewer tiles.
+func newTilesetImage(tiles []tileRows, numPlanes, widthTiles int, palette color.Palette) (*PlanarImage, error) {
+	if widthTiles <= 0 {
+		widthTiles = max(defaultTilesetWidthTiles, (len(tiles)+MaxTilesetHeightTiles-1)/MaxTilesetHeightTiles)
+	}
+	widthTiles = max(min(widthTiles, len(tiles)), 1)
+	heightTiles := max((len(tiles)+widthTiles-1)/widthTiles, 1)
+
+	planes := make([]Bitplane, numPlanes)
+	for p := range planes {
+		planes[p] = *NewBitplane(uint64(widthTiles*tileSizePx), uint64(heightTiles*tileSizePx))
+	}
+	result, err := NewPlanarImageFromBitplanes(planes, palette)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range tiles {
+		result.setTile(i%widthTiles, i/widthTiles, t)
+	}
+	return result, nil
+}
+
+// RenderTilemap rebuilds the image described by a tilemap out of a tileset image.
+func RenderTilemap(tileset *PlanarImage, tilemap *Tilemap) (*PlanarImage, error) {
+	if tileset.width%tileSizePx != 0 || tileset.height%tileSizePx != 0 {
+		return nil, fmt.Errorf("tileset image size %dx%d is not a multiple of %d pixels", tileset.width, tileset.height, tileSizePx)
+	}
+	if len(tilemap.Entries) != tilemap.WidthTiles*tilemap.HeightTiles {
+		return nil, fmt.Errorf("a %dx%d tilemap needs %d entries, got %d", tilemap.WidthTiles, tilemap.HeightTiles, tilemap.WidthTiles*tilemap.HeightTiles, len(tilemap.Entries))
+	}
+	tilesetWidthTiles := int(tileset.width / tileSizePx)
+	numTiles := tilesetWidthTiles * int(tileset.height/tileSizePx)
+
+	planes := make([]Bitplane, len(tileset.planes))
+	for p := range planes {
+		planes[p] = *NewBitplane(uint64(tilemap.WidthTiles*tileSizePx), uint64(tilemap.HeightTiles*tileSizePx))
+	}
+	result, err := NewPlanarImageFromBitplanes(planes, tileset.palette)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range tilemap.Entries {
+		if entry.Tile >= numTiles {
+			return nil, fmt.Errorf("tilemap entry %d refers to tile %d, but the tileset only has %d", i, entry.Tile, numTiles)
+		}
+		t := tileset.getTile(entry.Tile%tilesetWidthTiles, entry.Tile/tilesetWidthTiles)
+		result.setTile(i%tilemap.WidthTiles, i/tilemap.WidthTiles, t.flipped(entry.HFlip, entry.VFlip))
+	}
+	return result, nil
+}
@@ -1,74 +1,395 @@
 package main
 
 import (
-	// "flag"
+	"flag"
 	"fmt"
-	"image"
+	"image/color"
+	"image/png"
 	"log"
 	"os"
+	"strings"
 
-	_ "image/png"
+	_ "image/gif"
 
 	"github.com/Kagamiin/pixcrumb/cmd/comp"
 	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
 )
 
+var (
+	codecName       = flag.String("codec", "pcrle", "codec to compress with ("+strings.Join(comp.GetPixCrumbCodecNames(), ", ")+")")
+	inputFormat     = flag.String("informat", "image", "input format: 'image' for image files, 'ilbm' for planar IFF ILBM files, 'degas' or 'neo' for Atari ST pictures, 'raw' for headerless planar data, or a raw tile format (gb, nes, snes4, sms, genesis)")
+	tileInputWidth  = flag.Int("tilewidth", 16, "width in tiles of raw tile input")
+	rawInputWidth   = flag.Uint64("rawwidth", 320, "width in pixels of raw planar input")
+	rawInputHeight  = flag.Uint64("rawheight", 200, "height in pixels of raw planar input")
+	rawInputPlanes  = flag.Int("rawplanes", 4, "number of bitplanes of raw planar input")
+	rawInterleaving = flag.String("rawinterleave", "line", "plane interleave mode of raw planar input (none, line, word)")
+	imagePalette    = addPaletteFlags(flag.CommandLine)
+	imageMask       = addMaskFlags(flag.CommandLine)
+	ditherReport    = flag.Bool("ditherreport", false, "report the compressed size of quantized images under every dithering method")
+	optimizePalette = flag.Bool("optimizepalette", false, "search for the palette index order that minimizes compressed size")
+	backgroundIndex = flag.Int("background", -1, "palette index of the background color kept at index 0 by -optimizepalette (default: most common color)")
+	paletteOutFile  = flag.String("palout", "", "write the final palette to this file (JASC-PAL)")
+	restartRows     = flag.Int("restartrows", 0, "insert a restart point every this many crumb rows (2 pixels each), in codecs that support them")
+	verify          = flag.Bool("verify", false, "decode the compressed output and check that it matches the input")
+	diffOutFile     = flag.String("diffout", "", "where -verify writes the image highlighting mismatched pixels (default: input file name + .diff.png)")
+	outFormat       = flag.String("outformat", "", "decode the compressed bitplanes and save the result in this format: png, ilbm, or a raw tile format (gb, nes, snes4, sms, genesis)")
+	outFile         = flag.String("out", "", "where -outformat saves the decoded image (default: input file name + .out. + format name)")
+)
+
 func main() {
 	log.SetFlags(0)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			runBench(os.Args[2:])
+			return
+		case "conformance":
+			runConformance(os.Args[2:])
+			return
+		case "anim":
+			runAnim(os.Args[2:])
+			return
+		case "tileset":
+			runTileset(os.Args[2:])
+			return
+		}
+	}
+	flag.Parse()
 
-	if len(os.Args) < 2 {
+	if flag.NArg() < 1 {
 		log.Fatal("error: an input file must be specified")
 	}
 
-	for _, filename := range os.Args[1:] {
+	codec, err := comp.NewPixCrumbCodecByName(*codecName)
+	handle(err)
+	if *restartRows != 0 {
+		restartCodec, ok := codec.(comp.PixCrumbRestartEncoder)
+		if !ok {
+			log.Fatalf("error: codec %s does not support restart points", codec.GetAbbrevName())
+		}
+		handle(restartCodec.SetRestartInterval(*restartRows))
+	}
+
+	for _, filename := range flag.Args() {
 		fmt.Println("#======================================================================#")
 		fmt.Printf("| Test: %-63s|\n", filename)
 		fmt.Println("#======================================================================#")
 
-		img, err := imgtools.LoadImage(filename)
+		if *ditherReport {
+			if err := reportDitherSizes(filename, codec); err != nil {
+				log.Printf("\nERROR: Could not produce dithering report for '%s': %s\n\n", filename, err.Error())
+			}
+			continue
+		}
+
+		planarImg, err := loadPlanarImage(filename)
 		if err != nil {
 			log.Printf("\nERROR: Could not load image file '%s': %s\n\n", filename, err.Error())
 			continue
 		}
+		if *imageMask.enabled {
+			transparentIndex, err := imageMask.transparentIndexFor(planarImg.GetPalette())
+			if err == nil {
+				err = planarImg.SetMask(planarImg.TransparencyMask(transparentIndex))
+			}
+			if err != nil {
+				log.Printf("\nERROR: Could not add a mask to '%s': %s\n\n", filename, err.Error())
+				continue
+			}
+			fmt.Printf("Masking out color %d\n", transparentIndex)
+		}
+
+		if *verify {
+			diffFile := *diffOutFile
+			if diffFile == "" {
+				diffFile = filename + ".diff.png"
+			}
+			if err := verifyRoundTrip(planarImg, codec, diffFile); err != nil {
+				log.Printf("\nERROR: Round-trip verification failed for '%s': %s\n\n", filename, err.Error())
+			}
+		}
 
-		compPlaneBlobs, err := compressImageIntoPixCrumbBlobs(img, comp.NewPixCrumbRLEEncoder())
+		width, height, palette, hasMask := planarImg.GetWidthPx(), planarImg.GetHeightPx(), planarImg.GetPalette(), planarImg.GetMask() != nil
+		compPlaneBlobs, err := compressImageIntoPixCrumbBlobs(planarImg, codec)
 		if err != nil {
 			log.Println(err)
+			continue
+		}
+
+		if *outFormat != "" {
+			outName := *outFile
+			if outName == "" {
+				outName = filename + ".out." + *outFormat
+			}
+			decoded, err := decodePixCrumbBlobs(compPlaneBlobs, codec.GetAbbrevName(), width, height, palette, hasMask)
+			if err == nil {
+				err = saveImage(outName, decoded, *outFormat)
+			}
+			if err != nil {
+				log.Printf("\nERROR: Could not save decoded image for '%s': %s\n\n", filename, err.Error())
+				continue
+			}
+			fmt.Printf("Decoded image written to %s\n\n", outName)
 		}
-		_ = compPlaneBlobs
-		// TODO: decompress and save image
 	}
 }
 
-func compressImageIntoPixCrumbBlobs(img image.PalettedImage, codec comp.PixCrumbEncoder) ([]comp.PixCrumbBlob, error) {
-	planarImg, err := imgtools.NewPlanarImage(img)
+// decodePixCrumbBlobs decodes the compressed bitplanes of an image, as a decoder reading them from a file would. With
+// hasMask set, the first blob is the image's mask.
+func decodePixCrumbBlobs(blobs []comp.PixCrumbBlob, codecName string, width, height uint64, palette color.Palette, hasMask bool) (*imgtools.PlanarImage, error) {
+	var data [][]byte
+	for _, blob := range blobs {
+		d, err := blob.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, d)
+	}
+	planes, err := decodeBitplanes(codecName, data, width, height)
 	if err != nil {
 		return nil, err
 	}
-	bitplanes := planarImg.GetBitplanes()
+	return newPlanarImageFromDecodedPlanes(planes, palette, hasMask)
+}
+
+// saveImage writes a planar image to a file in the given format: png, ilbm (ByteRun1-compressed), or one of the raw
+// tile formats.
+func saveImage(filename string, pi *imgtools.PlanarImage, format string) error {
+	switch format {
+	case "ilbm":
+		return imgtools.SaveILBM(filename, pi, true)
+	case "png":
+		f, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		if err := png.Encode(f, pi.ToPaletted()); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	tileFormat, err := imgtools.ParseTileFormat(format)
+	if err != nil {
+		return err
+	}
+	return imgtools.SaveTiles(filename, pi, tileFormat)
+}
+
+func loadPlanarImage(filename string) (*imgtools.PlanarImage, error) {
+	switch *inputFormat {
+	case "image":
+		opts, err := imagePalette.options()
+		if err != nil {
+			return nil, err
+		}
+		img, err := imgtools.LoadImageWithOptions(filename, opts)
+		if err != nil {
+			return nil, err
+		}
+		if *optimizePalette {
+			codec, err := comp.NewPixCrumbCodecByName(*codecName)
+			if err != nil {
+				return nil, err
+			}
+			img, err = imgtools.OptimizePaletteOrder(img, imgtools.PaletteOptimizeOptions{
+				BackgroundIndex: *backgroundIndex,
+				Cost:            compressedSizeCost(codec),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if *paletteOutFile != "" {
+			if err := imgtools.SavePaletteFile(*paletteOutFile, img.ColorModel().(color.Palette)); err != nil {
+				return nil, err
+			}
+		}
+		return imgtools.NewPlanarImage(img)
+	case "ilbm":
+		return imgtools.LoadILBM(filename)
+	case "degas":
+		return imgtools.LoadDegas(filename)
+	case "neo":
+		return imgtools.LoadNEOchrome(filename)
+	case "raw":
+		mode, err := imgtools.ParsePlaneInterleave(*rawInterleaving)
+		if err != nil {
+			return nil, err
+		}
+		return imgtools.LoadRawPlanar(filename, *rawInputWidth, *rawInputHeight, *rawInputPlanes, mode)
+	}
+
+	tileFormat, err := imgtools.ParseTileFormat(*inputFormat)
+	if err != nil {
+		return nil, err
+	}
+	return imgtools.LoadTiles(filename, tileFormat, *tileInputWidth)
+}
+
+// paletteFlags are the options for building the palettes of loaded images, shared by the main command and the
+// subcommands that load images.
+type paletteFlags struct {
+	size, numBitplanes                       *int
+	order, refPaletteFile, quantizer, dither *string
+}
+
+func addPaletteFlags(flags *flag.FlagSet) *paletteFlags {
+	return &paletteFlags{
+		size:           flags.Int("palettesize", 0, "pad image palettes to this many colors (default: next power of two)"),
+		numBitplanes:   flags.Int("bitplanes", 0, "pad image palettes to fill this many bitplanes (overrides -palettesize)"),
+		order:          flags.String("paletteorder", "firstseen", "index order of palettes built for non-paletted images (firstseen, frequency, luminance)"),
+		refPaletteFile: flags.String("refpalette", "", "remap images onto the palette from this file (JASC-PAL, raw RGB or paletted image)"),
+		quantizer:      flags.String("quantize", "none", "quantization method for images with too many colors (none, mediancut, kmeans)"),
+		dither:         flags.String("dither", "none", "dithering method used when quantizing (none, ordered, floydsteinberg)"),
+	}
+}
+
+func (pf *paletteFlags) options() (opts imgtools.PaletteOptions, err error) {
+	opts.FixedPaletteSize = *pf.size
+	opts.FixedNumBitplanes = *pf.numBitplanes
+	opts.Order, err = imgtools.ParsePaletteOrder(*pf.order)
+	if err != nil {
+		return
+	}
+	if *pf.refPaletteFile != "" {
+		opts.ReferencePalette, err = imgtools.LoadPaletteFile(*pf.refPaletteFile)
+		if err != nil {
+			return
+		}
+	}
+	opts.Quantizer, err = imgtools.ParseQuantizeMethod(*pf.quantizer)
+	if err != nil {
+		return
+	}
+	opts.Dither, err = imgtools.ParseDitherMethod(*pf.dither)
+	return
+}
+
+// maskFlags are the options for adding a transparency mask to images, shared by the main command and anim.
+type maskFlags struct {
+	enabled          *bool
+	transparentIndex *int
+}
+
+func addMaskFlags(flags *flag.FlagSet) *maskFlags {
+	return &maskFlags{
+		enabled:          flags.Bool("mask", false, "add a transparency mask bitplane, set for opaque pixels, to the compressed bitplanes"),
+		transparentIndex: flags.Int("transparent", -1, "palette index that -mask makes transparent (default: the first fully transparent palette color, e.g. from a PNG tRNS chunk)"),
+	}
+}
+
+// transparentIndexFor returns the palette index -mask makes transparent in images with the given palette.
+func (mf *maskFlags) transparentIndexFor(palette color.Palette) (int, error) {
+	idx := *mf.transparentIndex
+	if idx < 0 {
+		idx = imgtools.TransparentIndex(palette)
+		if idx < 0 {
+			return 0, fmt.Errorf("the palette has no transparent color, pick one with -transparent")
+		}
+	}
+	if idx >= len(palette) {
+		return 0, fmt.Errorf("transparent color %d is out of range for a palette of %d colors", idx, len(palette))
+	}
+	return idx, nil
+}
+
+func reportDitherSizes(filename string, codec comp.PixCrumbEncoder) error {
+	opts, err := imagePalette.options()
+	if err != nil {
+		return err
+	}
+	if opts.Quantizer == imgtools.QuantizeNone {
+		opts.Quantizer = imgtools.QuantizeMedianCut
+	}
+
+	fmt.Printf("\nDithering report using method %s, quantizer %s:\n", codec.GetName(), opts.Quantizer)
+	for _, dither := range imgtools.DitherMethods {
+		opts.Dither = dither
+		img, err := imgtools.LoadImageWithOptions(filename, opts)
+		if err != nil {
+			return err
+		}
+		planarImg, err := imgtools.NewPlanarImage(img)
+		if err != nil {
+			return err
+		}
+		blobs, rawSizes, err := compressPlanarImage(planarImg, codec)
+		if err != nil {
+			return err
+		}
+		var totalSizeRaw, totalSizeComp uint64
+		for i, blob := range blobs {
+			totalSizeRaw += rawSizes[i]
+			totalSizeComp += blob.GetTotalSize()
+		}
+		fmt.Printf("%-16s %d colors: raw size %d bytes, compressed to %d bytes (ratio: %.03f)\n", dither.String()+":", len(img.ColorModel().(color.Palette)), totalSizeRaw, totalSizeComp, float64(totalSizeComp)/float64(totalSizeRaw))
+	}
+	fmt.Println()
+	return nil
+}
+
+func compressedSizeCost(codec comp.PixCrumbEncoder) imgtools.PaletteCostFunc {
+	return func(pi *imgtools.PlanarImage) (uint64, error) {
+		blobs, _, err := compressPlanarImage(pi, codec)
+		if err != nil {
+			return 0, err
+		}
+		var size uint64
+		for _, blob := range blobs {
+			size += blob.GetTotalSize()
+		}
+		return size, nil
+	}
+}
+
+// compressPlanarImage delta-encodes the bitplanes of an image in place and compresses them, starting with its mask if
+// it has one.
+func compressPlanarImage(planarImg *imgtools.PlanarImage, codec comp.PixCrumbEncoder) (blobs []comp.PixCrumbBlob, rawSizes []uint64, err error) {
+	bitplanes := planarImg.GetBitplanesWithMask()
 
 	for _, bp := range bitplanes {
 		bp.DeltaEncode()
 	}
 
-	crumbImage := imgtools.ImagePlanarToCrumb(planarImg)
-	crumbPlanes := crumbImage.GetPlanes()
+	for i, bp := range bitplanes {
+		blob, err := codec.Compress(imgtools.BitplaneToCrumbPlane(&bp))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error while encoding %s: %w", planeName(planarImg, i), err)
+		}
+		blobs = append(blobs, blob)
+		rawSizes = append(rawSizes, bp.GetTotalSize())
+	}
+	return
+}
+
+// planeName names the i-th bitplane returned by GetBitplanesWithMask in messages: Mask, or BP<n> for color
+// bitplane n.
+func planeName(planarImg *imgtools.PlanarImage, i int) string {
+	if planarImg.GetMask() == nil {
+		return fmt.Sprintf("BP%d", i)
+	}
+	if i == 0 {
+		return "Mask"
+	}
+	return fmt.Sprintf("BP%d", i-1)
+}
 
-	var compressedBlobs []comp.PixCrumbBlob
+func compressImageIntoPixCrumbBlobs(planarImg *imgtools.PlanarImage, codec comp.PixCrumbEncoder) ([]comp.PixCrumbBlob, error) {
+	compressedBlobs, rawSizes, err := compressPlanarImage(planarImg, codec)
+	if err != nil {
+		return nil, err
+	}
 
 	var totalSizeRaw, totalSizeComp uint64
 	fmt.Printf("\nUsing method %s:\n", codec.GetName())
-	for i, crp := range crumbPlanes {
-		rawSize := bitplanes[i].GetTotalSize()
-		comp, err := codec.Compress(&crp)
-		if err != nil {
-			return nil, fmt.Errorf("error while encoding BP%d: %w", i, err)
-		}
-		compSize := comp.GetTotalSize()
-		fmt.Printf("BP%d raw size: %d bytes, compressed to %d bytes (ratio: %.03f)\n", i, rawSize, compSize, float64(compSize)/float64(rawSize))
+	for i, blob := range compressedBlobs {
+		rawSize := rawSizes[i]
+		compSize := blob.GetTotalSize()
+		fmt.Printf("%s raw size: %d bytes, compressed to %d bytes (ratio: %.03f)\n", planeName(planarImg, i), rawSize, compSize, float64(compSize)/float64(rawSize))
 		totalSizeRaw += rawSize
 		totalSizeComp += compSize
-		compressedBlobs = append(compressedBlobs, comp)
 	}
 	fmt.Printf("Total: raw size %d bytes, compressed to %d bytes (ratio: %.03f)\n\n", totalSizeRaw, totalSizeComp, float64(totalSizeComp)/float64(totalSizeRaw))
 	return compressedBlobs, nil
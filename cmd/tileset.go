@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+var ErrTilesetMismatch = errors.New("image rebuilt from the tileset does not match the input")
+
+// encodeTileset puts a compressed tileset and its tilemap into a container. The tilemap is compressed too, unless
+// rawTilemap is set.
+func encodeTileset(tileset *imgtools.PlanarImage, tilemap *imgtools.Tilemap, codec comp.PixCrumbEncoder, rawTilemap bool) (*comp.Container, error) {
+	planes, _, err := compressFrame(tileset, codec)
+	if err != nil {
+		return nil, err
+	}
+	coding, tilemapData := uint8(comp.ContainerTilemapCompressed), comp.CompressTilemap(tilemap.Words())
+	if rawTilemap {
+		coding, tilemapData = comp.ContainerTilemapWords, tilemap.MarshalWords()
+	}
+	return &comp.Container{
+		Width:     int(tileset.GetWidthPx()),
+		Height:    int(tileset.GetHeightPx()),
+		NumPlanes: len(tileset.GetBitplanes()),
+		CodecName: codec.GetAbbrevName(),
+		Palette:   tileset.GetPalette(),
+		Frames:    []comp.ContainerFrame{{Flags: comp.ContainerFrameKeyframe, Planes: planes}},
+		Tilemap: &comp.ContainerTilemap{
+			WidthTiles:  tilemap.WidthTiles,
+			HeightTiles: tilemap.HeightTiles,
+			NumTiles:    countTiles(tilemap),
+			Coding:      coding,
+			Data:        tilemapData,
+		},
+	}, nil
+}
+
+// countTiles returns the number of tiles a tilemap uses, assuming they are numbered in order of first appearance.
+func countTiles(tilemap *imgtools.Tilemap) int {
+	numTiles := 0
+	for _, e := range tilemap.Entries {
+		numTiles = max(numTiles, e.Tile+1)
+	}
+	return numTiles
+}
+
+// decodeTileset decodes the tileset and tilemap of a container and renders the image they describe.
+func decodeTileset(c *comp.Container) (*imgtools.PlanarImage, error) {
+	if len(c.Frames) != 1 || c.Tilemap == nil {
+		return nil, fmt.Errorf("container does not hold a tileset (%d frames, tilemap: %t)", len(c.Frames), c.Tilemap != nil)
+	}
+	if c.HasMask() {
+		return nil, fmt.Errorf("tilesets with a mask are not supported")
+	}
+	planes, err := decodeContainerPlanes(c, &c.Frames[0])
+	if err != nil {
+		return nil, err
+	}
+	tileset, err := imgtools.NewPlanarImageFromBitplanes(planes, c.Palette)
+	if err != nil {
+		return nil, err
+	}
+	tilemap, err := decodeContainerTilemap(c.Tilemap)
+	if err != nil {
+		return nil, err
+	}
+	return imgtools.RenderTilemap(tileset, tilemap)
+}
+
+func decodeContainerTilemap(tm *comp.ContainerTilemap) (*imgtools.Tilemap, error) {
+	switch tm.Coding {
+	case comp.ContainerTilemapWords:
+		return imgtools.UnmarshalTilemapWords(tm.WidthTiles, tm.HeightTiles, tm.Data)
+	case comp.ContainerTilemapCompressed:
+		words, err := comp.DecompressTilemap(tm.Data, tm.WidthTiles*tm.HeightTiles)
+		if err != nil {
+			return nil, fmt.Errorf("tilemap: %w", err)
+		}
+		return imgtools.NewTilemapFromWords(tm.WidthTiles, tm.HeightTiles, words)
+	}
+	return nil, fmt.Errorf("unknown tilemap coding %d", tm.Coding)
+}
+
+// verifyTileset decodes a marshaled container and compares the image rebuilt from it with the input.
+func verifyTileset(data []byte, img *imgtools.PlanarImage) error {
+	var container comp.Container
+	if err := container.Unmarshal(data); err != nil {
+		return err
+	}
+	decoded, err := decodeTileset(&container)
+	if err != nil {
+		return err
+	}
+	if decoded.GetWidthPx() < img.GetWidthPx() || decoded.GetHeightPx() < img.GetHeightPx() {
+		return fmt.Errorf("%w: rebuilt image is %dx%d, expected at least %dx%d", ErrTilesetMismatch, decoded.GetWidthPx(), decoded.GetHeightPx(), img.GetWidthPx(), img.GetHeightPx())
+	}
+	for y := range img.GetHeightPx() {
+		for x := range img.GetWidthPx() {
+			if decoded.ColorIndexAt(x, y) != img.ColorIndexAt(x, y) {
+				return fmt.Errorf("%w: differs at pixel (%d, %d)", ErrTilesetMismatch, x, y)
+			}
+		}
+	}
+	return nil
+}
+
+func runTileset(args []string) {
+	flags := flag.NewFlagSet("tileset", flag.ExitOnError)
+	codecName := flags.String("codec", "pcrle", "codec to compress the tileset with ("+strings.Join(comp.GetPixCrumbCodecNames(), ", ")+")")
+	outFile := flags.String("o", "", "output container file (default: input file name + .pxc)")
+	flips := flags.Bool("flips", true, "deduplicate horizontally and vertically flipped tiles")
+	tilesetWidth := flags.Int("tilesetwidth", 0, "width of the tileset image, in tiles (default: 16, or wider if the tiles don't fit in 63 rows)")
+	tilesetOutFile := flags.String("tilesetout", "", "also write the uncompressed tileset to this PNG file")
+	rawTilemap := flags.Bool("rawtilemap", false, "store the tilemap as raw 16-bit words instead of compressing it")
+	verifyOutput := flags.Bool("verify", false, "decode the container and check that it rebuilds the input image")
+	palette := addPaletteFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s tileset [flags] <image file>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	filename := flags.Arg(0)
+	if *outFile == "" {
+		*outFile = filename + ".pxc"
+	}
+
+	codec, err := comp.NewPixCrumbCodecByName(*codecName)
+	handle(err)
+	paletteOpts, err := palette.options()
+	handle(err)
+	img, err := imgtools.LoadImageWithOptions(filename, paletteOpts)
+	handle(err)
+	planarImg, err := imgtools.NewPlanarImage(img)
+	handle(err)
+
+	tileset, tilemap, err := imgtools.ExtractTileset(planarImg, imgtools.TilesetOptions{Flips: *flips, WidthTiles: *tilesetWidth})
+	handle(err)
+	var numFlipped int
+	for _, e := range tilemap.Entries {
+		if e.HFlip || e.VFlip {
+			numFlipped++
+		}
+	}
+	numTiles := countTiles(tilemap)
+	fmt.Printf("%dx%d tilemap, %d distinct tiles out of %d (%d placed flipped)\n", tilemap.WidthTiles, tilemap.HeightTiles, numTiles, len(tilemap.Entries), numFlipped)
+
+	if *tilesetOutFile != "" {
+		f, err := os.Create(*tilesetOutFile)
+		handle(err)
+		handle(png.Encode(f, tileset.ToPaletted()))
+		handle(f.Close())
+	}
+
+	container, err := encodeTileset(tileset, tilemap, codec, *rawTilemap)
+	handle(err)
+	tilesetSize := 0
+	for _, data := range container.Frames[0].Planes {
+		tilesetSize += len(data)
+	}
+	data, err := container.Marshal()
+	handle(err)
+	fmt.Printf("Tileset (%dx%d pixels) compressed with %s to %d bytes, tilemap %d bytes (%d bytes raw), %d bytes with container\n", tileset.GetWidthPx(), tileset.GetHeightPx(), codec.GetName(), tilesetSize, len(container.Tilemap.Data), len(tilemap.Entries)*2, len(data))
+	handle(os.WriteFile(*outFile, data, 0644))
+	fmt.Printf("Written to %s\n", *outFile)
+
+	if *verifyOutput {
+		handle(verifyTileset(data, planarImg))
+		fmt.Println("Tileset and tilemap rebuild the image correctly.")
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"slices"
+
+	"github.com/Kagamiin/pixcrumb/cmd/comp"
+	"github.com/Kagamiin/pixcrumb/cmd/comp/codingmethods"
+	"github.com/Kagamiin/pixcrumb/cmd/imgtools"
+)
+
+var ErrRoundTripMismatch = errors.New("decoded image does not match the original")
+
+// decodeForVerification decodes a blob from its marshaled form, like a real decoder would.
+func decodeForVerification(codecName string, blob comp.PixCrumbBlob) (crp *imgtools.CrumbPlane, trace []comp.DecodeCheckpoint, err error) {
+	data, err := blob.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	return decodePlaneData(codecName, data)
+}
+
+// decodePlaneData decodes a marshaled blob, turning decoder panics into errors.
+func decodePlaneData(codecName string, data []byte) (crp *imgtools.CrumbPlane, trace []comp.DecodeCheckpoint, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("decoder panicked: %v", r)
+		}
+	}()
+
+	decoder, err := comp.NewPixCrumbCodecByName(codecName)
+	if err != nil {
+		return nil, nil, err
+	}
+	decodedBlob := decoder.NewBlob()
+	if err := decodedBlob.Unmarshal(data); err != nil {
+		return nil, nil, err
+	}
+	if err := decoder.LoadBlob(decodedBlob); err != nil {
+		return nil, nil, err
+	}
+	crp, err = decoder.Decompress()
+	if tracer, ok := decoder.(comp.PixCrumbTracingDecoder); ok {
+		trace = tracer.GetDecodeTrace()
+	}
+	return crp, trace, err
+}
+
+// decodeBitplanes decodes the marshaled blobs of an image's bitplanes and undoes their delta encoding, cropping them
+// to the size of the image.
+func decodeBitplanes(codecName string, blobs [][]byte, width, height uint64) ([]imgtools.Bitplane, error) {
+	var planes []imgtools.Bitplane
+	for p, data := range blobs {
+		crp, _, err := decodePlaneData(codecName, data)
+		if err != nil {
+			return nil, comp.WithDecodePlane(err, p)
+		}
+		bp := imgtools.CrumbPlaneToBitplane(crp)
+		bp.DeltaDecode()
+		cropped, err := bp.Crop(width, height)
+		if err != nil {
+			return nil, comp.WithDecodePlane(err, p)
+		}
+		planes = append(planes, *cropped)
+	}
+	return planes, nil
+}
+
+// newPlanarImageFromDecodedPlanes builds an image out of decoded bitplanes, which start with its mask if hasMask is
+// set.
+func newPlanarImageFromDecodedPlanes(planes []imgtools.Bitplane, palette color.Palette, hasMask bool) (*imgtools.PlanarImage, error) {
+	if !hasMask {
+		return imgtools.NewPlanarImageFromBitplanes(planes, palette)
+	}
+	if len(planes) < 2 {
+		return nil, fmt.Errorf("a masked image needs at least 2 bitplanes, got %d", len(planes))
+	}
+	img, err := imgtools.NewPlanarImageFromBitplanes(planes[1:], palette)
+	if err != nil {
+		return nil, err
+	}
+	if err := img.SetMask(&planes[0]); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// verifyRestartPoints decodes a marshaled blob from each of its restart points, checking that every one yields the
+// same crumb rows as decoding the whole plane.
+func verifyRestartPoints(codecName string, data []byte, full *imgtools.CrumbPlane) (numRestarts int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("decoder panicked: %v", r)
+		}
+	}()
+
+	codec, err := comp.NewPixCrumbCodecByName(codecName)
+	if err != nil {
+		return 0, err
+	}
+	decoder, ok := codec.(comp.PixCrumbRestartDecoder)
+	if !ok {
+		return 0, nil
+	}
+	blob := decoder.NewBlob()
+	if err := blob.Unmarshal(data); err != nil {
+		return 0, err
+	}
+	if err := decoder.LoadBlob(blob); err != nil {
+		return 0, err
+	}
+	fullRows := full.GetCrumbs()
+	for restart := 1; restart < decoder.GetNumRestartPoints(); restart++ {
+		crp, err := decoder.DecompressFromRestart(restart)
+		if err != nil {
+			return 0, fmt.Errorf("restart point %d: %w", restart, err)
+		}
+		rows := crp.GetCrumbs()
+		firstRow := restart * decoder.GetRestartInterval()
+		if firstRow+len(rows) != len(fullRows) {
+			return 0, fmt.Errorf("restart point %d: decoded %d crumb rows, expected %d", restart, len(rows), len(fullRows)-firstRow)
+		}
+		for y, row := range rows {
+			if !slices.Equal(row, fullRows[firstRow+y]) {
+				return 0, fmt.Errorf("restart point %d: crumb row %d differs from a full decode", restart, firstRow+y)
+			}
+		}
+	}
+	return decoder.GetNumRestartPoints(), nil
+}
+
+// verifyIncrementalDecoding decodes a marshaled blob one crumb row at a time, checking that it yields the same crumb
+// rows as decoding the whole plane at once.
+func verifyIncrementalDecoding(codecName string, data []byte, full *imgtools.CrumbPlane) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("decoder panicked: %v", r)
+		}
+	}()
+
+	codec, err := comp.NewPixCrumbCodecByName(codecName)
+	if err != nil {
+		return err
+	}
+	decoder, ok := codec.(comp.PixCrumbStreamingDecoder)
+	if !ok {
+		return nil
+	}
+	blob := decoder.NewBlob()
+	if err := blob.Unmarshal(data); err != nil {
+		return err
+	}
+	if err := decoder.LoadBlob(blob); err != nil {
+		return err
+	}
+	incDecoder, err := decoder.NewIncrementalDecoder()
+	if err != nil {
+		return err
+	}
+	for y, fullRow := range full.GetCrumbs() {
+		row, err := incDecoder.NextRow()
+		if err != nil {
+			return fmt.Errorf("incremental decoding failed at crumb row %d: %w", y, err)
+		}
+		if !slices.Equal(row, fullRow) {
+			return fmt.Errorf("incrementally decoded crumb row %d differs from a full decode", y)
+		}
+	}
+	if !incDecoder.IsDone() {
+		return fmt.Errorf("incremental decoder has crumbs left past the end of the plane")
+	}
+	return nil
+}
+
+// findCrumbMismatch compares two crumb planes in CrumbReader order, returning the index and coordinates of the first
+// crumb that differs (or is missing from one of them).
+func findCrumbMismatch(expected, decoded *imgtools.CrumbPlane) (idx int64, y, x int, found bool, err error) {
+	expectedMtx, decodedMtx := expected.GetCrumbs(), decoded.GetCrumbs()
+	expectedReader, err := codingmethods.NewCrumbReader(&expectedMtx)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	if len(decodedMtx) == 0 || len(decodedMtx[0]) != len(expectedMtx[0]) {
+		return 0, 0, 0, true, nil
+	}
+	decodedReader, err := codingmethods.NewCrumbReader(&decodedMtx)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	for !expectedReader.IsAtEnd() {
+		idx = expectedReader.Tell()
+		y, x = expectedReader.TellCoords()
+		if decodedReader.IsAtEnd() {
+			return idx, y, x, true, nil
+		}
+		c1, err := expectedReader.ReadCrumb()
+		if err != nil {
+			return 0, 0, 0, false, err
+		}
+		c2, err := decodedReader.ReadCrumb()
+		if err != nil {
+			return 0, 0, 0, false, err
+		}
+		if c1 != c2 {
+			return idx, y, x, true, nil
+		}
+	}
+	if !decodedReader.IsAtEnd() {
+		y, x = decodedReader.TellCoords()
+		return decodedReader.Tell(), y, x, true, nil
+	}
+	return 0, 0, 0, false, nil
+}
+
+// verifyRoundTrip compresses a copy of the image, decodes the result and compares it with the original at the crumb,
+// bitplane and pixel levels. On a mismatch, a PNG highlighting the differing pixels is written to diffFile.
+func verifyRoundTrip(planarImg *imgtools.PlanarImage, codec comp.PixCrumbEncoder, diffFile string) error {
+	width, height := planarImg.GetWidthPx(), planarImg.GetHeightPx()
+	encodedImg := planarImg.Clone()
+	blobs, _, err := compressPlanarImage(encodedImg, codec)
+	if err != nil {
+		return err
+	}
+	var expectedCrumbs []imgtools.CrumbPlane
+	for _, bp := range encodedImg.GetBitplanesWithMask() {
+		expectedCrumbs = append(expectedCrumbs, *imgtools.BitplaneToCrumbPlane(&bp))
+	}
+	originalPlanes := planarImg.GetBitplanesWithMask()
+
+	fmt.Printf("\nVerifying round trip with method %s:\n", codec.GetName())
+	mismatch := false
+	decodedPlanes := make([]imgtools.Bitplane, len(blobs))
+	for i, blob := range blobs {
+		name := planeName(planarImg, i)
+		decodedPlanes[i] = *imgtools.NewBitplane(width, height)
+
+		decodedCrumbs, trace, err := decodeForVerification(codec.GetAbbrevName(), blob)
+		if err != nil {
+			fmt.Printf("Decoding failed: %s: %s\n", name, err.Error())
+			mismatch = true
+			continue
+		}
+
+		idx, y, x, found, err := findCrumbMismatch(&expectedCrumbs[i], decodedCrumbs)
+		if err != nil {
+			return err
+		}
+		if !found {
+			data, err := blob.Marshal()
+			if err != nil {
+				return err
+			}
+			if numRestarts, err := verifyRestartPoints(codec.GetAbbrevName(), data, decodedCrumbs); err != nil {
+				fmt.Printf("%s: %s\n", name, err.Error())
+				mismatch = true
+			} else if numRestarts > 1 {
+				fmt.Printf("%s: decoding from each of %d restart points matches\n", name, numRestarts)
+			}
+			if err := verifyIncrementalDecoding(codec.GetAbbrevName(), data, decodedCrumbs); err != nil {
+				fmt.Printf("%s: %s\n", name, err.Error())
+				mismatch = true
+			}
+		}
+		if found {
+			mismatch = true
+			fmt.Printf("%s: first differing crumb is #%d, at crumb row %d, column %d", name, idx, y, x)
+			if cp, ok := comp.FindDecodeCheckpoint(trace, idx); ok {
+				fmt.Printf(" (decoded from %s stream at bit offset %d, byte %d)", cp.Stream, cp.BitOffset, cp.BitOffset/8)
+			}
+			fmt.Println()
+		}
+
+		decodedBp := imgtools.CrumbPlaneToBitplane(decodedCrumbs)
+		decodedBp.DeltaDecode()
+		var badPixels uint64
+		for py := range min(height, decodedBp.GetHeightPx()) {
+			for px := range min(width, decodedBp.GetWidthPx()) {
+				bit := decodedBp.GetPixel(px, py)
+				decodedPlanes[i].SetPixel(px, py, bit)
+				if bit != originalPlanes[i].GetPixel(px, py) {
+					if badPixels == 0 {
+						fmt.Printf("%s: first differing pixel at (%d, %d)\n", name, px, py)
+					}
+					badPixels++
+				}
+			}
+		}
+		if badPixels > 0 {
+			mismatch = true
+			fmt.Printf("%s: %d pixels differ\n", name, badPixels)
+		}
+	}
+
+	if !mismatch {
+		fmt.Println("All bitplanes decoded correctly.")
+		return nil
+	}
+
+	decodedImg, err := newPlanarImageFromDecodedPlanes(decodedPlanes, planarImg.GetPalette(), planarImg.GetMask() != nil)
+	if err != nil {
+		return err
+	}
+	var badPixels uint64
+	diff := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	palette := planarImg.GetPalette()
+	for y := range height {
+		for x := range width {
+			idx := planarImg.ColorIndexAt(x, y)
+			if decodedImg.ColorIndexAt(x, y) != idx {
+				diff.Set(int(x), int(y), color.RGBA{0xFF, 0x00, 0xFF, 0xFF})
+				badPixels++
+				continue
+			}
+			// Correct pixels are dimmed so that the bad ones stand out.
+			r, g, b, _ := palette[int(idx)%len(palette)].RGBA()
+			diff.Set(int(x), int(y), color.RGBA{uint8(r >> 10), uint8(g >> 10), uint8(b >> 10), 0xFF})
+		}
+	}
+	fmt.Printf("%d of %d pixels differ\n", badPixels, width*height)
+
+	if diffFile != "" {
+		f, err := os.Create(diffFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := png.Encode(f, diff); err != nil {
+			return err
+		}
+		fmt.Printf("Differences written to %s\n", diffFile)
+	}
+	return ErrRoundTripMismatch
+}